@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultAggregateCacheTTL = 5 * time.Minute
+
+type ServerStatisticsRequest struct {
+	Server ServerIdentifier `json:"server"`
+}
+
+type StatAggregate struct {
+	Sum     float64 `json:"sum" bson:"sum"`
+	Max     float64 `json:"max" bson:"max"`
+	Average float64 `json:"average" bson:"-"`
+	Players int64   `json:"players" bson:"players"`
+}
+
+type StatHighlight struct {
+	Key   string  `json:"key"`
+	Value float64 `json:"value"`
+}
+
+type ServerHighlights struct {
+	TotalBlocksMined    float64        `json:"totalBlocksMined"`
+	TotalBlocksPlaced   float64        `json:"totalBlocksPlaced"`
+	TotalPlayTime       float64        `json:"totalPlayTime"`
+	AverageDeaths       float64        `json:"averageDeaths"`
+	MostKilledMob       *StatHighlight `json:"mostKilledMob,omitempty"`
+	MostCraftedItem     *StatHighlight `json:"mostCraftedItem,omitempty"`
+	MostMinedBlock      *StatHighlight `json:"mostMinedBlock,omitempty"`
+	MostDeadlyEntity    *StatHighlight `json:"mostDeadlyEntity,omitempty"`
+	AverageAdvancements float64        `json:"averageAdvancements"`
+	AveragePlayTime     float64        `json:"averagePlayTime"`
+}
+
+type ServerStatistics struct {
+	Server     ServerIdentifier                                     `json:"server"`
+	Players    int64                                                `json:"players"`
+	Highlights ServerHighlights                                     `json:"highlights"`
+	Groups     map[database.StatGroupName]map[string]*StatAggregate `json:"groups"`
+	ComputedAt time.Time                                            `json:"computedAt"`
+}
+
+type aggregateCacheEntry struct {
+	statistics *ServerStatistics
+	expiresAt  time.Time
+}
+
+// AggregateCache keeps computed server statistics, since computing them touches every player document.
+type AggregateCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*aggregateCacheEntry
+	flights singleflight.Group
+}
+
+func NewAggregateCache(ttl time.Duration) *AggregateCache {
+	return &AggregateCache{
+		ttl:     ttl,
+		entries: make(map[string]*aggregateCacheEntry),
+	}
+}
+
+func (c *AggregateCache) Get(server ServerIdentifier) (*ServerStatistics, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[server.String()]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.statistics, true
+}
+
+func (c *AggregateCache) Put(server ServerIdentifier, statistics *ServerStatistics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[server.String()] = &aggregateCacheEntry{
+		statistics: statistics,
+		expiresAt:  time.Now().Add(c.ttl),
+	}
+}
+
+// Load returns cached statistics of a server or computes them. Concurrent misses of a server share
+// one computation, which runs detached from the requests, so a client going away doesn't fail the others.
+func (c *AggregateCache) Load(ctx context.Context, server ServerIdentifier) (*ServerStatistics, error) {
+	if statistics, ok := c.Get(server); ok {
+		return statistics, nil
+	}
+
+	flight := c.flights.DoChan(server.String(), func() (any, error) {
+		// Another flight may have finished between the cache check and this one
+		if statistics, ok := c.Get(server); ok {
+			return statistics, nil
+		}
+
+		ctx, cancel := BackgroundContext(OperationAggregate)
+		defer cancel()
+
+		statistics, err := ComputeServerStatistics(ctx, server)
+		if err != nil {
+			return nil, err
+		}
+
+		if statistics.Players > 0 {
+			c.Put(server, statistics)
+		}
+
+		return statistics, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-flight:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+
+		return result.Val.(*ServerStatistics), nil
+	}
+}
+
+// ServerStatisticsCache is replaced on startup with one using storage.aggregateCacheTTL.
+var ServerStatisticsCache = NewAggregateCache(defaultAggregateCacheTTL)
+
+// statsAggregationPipeline flattens stats of every player into group/key pairs and
+// computes sum, max and number of players having the stat for each of them.
+var statsAggregationPipeline = mongo.Pipeline{
+	{{Key: "$project", Value: bson.M{"groups": bson.M{"$objectToArray": "$stats"}}}},
+	{{Key: "$unwind", Value: "$groups"}},
+	{{Key: "$project", Value: bson.M{"group": "$groups.k", "entries": bson.M{"$objectToArray": "$groups.v"}}}},
+	{{Key: "$unwind", Value: "$entries"}},
+	{{Key: "$group", Value: bson.M{
+		"_id":     bson.M{"group": "$group", "key": "$entries.k"},
+		"sum":     bson.M{"$sum": "$entries.v"},
+		"max":     bson.M{"$max": "$entries.v"},
+		"players": bson.M{"$sum": 1},
+	}}},
+}
+
+type statsAggregationResult struct {
+	ID struct {
+		Group database.StatGroupName `bson:"group"`
+		Key   string                 `bson:"key"`
+	} `bson:"_id"`
+	StatAggregate `bson:",inline"`
+}
+
+func ComputeServerStatistics(ctx context.Context, server ServerIdentifier) (*ServerStatistics, error) {
+	collection := database.Database.Collection(server.String())
+
+	players, err := collection.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := collection.Aggregate(ctx, statsAggregationPipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*statsAggregationResult
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	statistics := &ServerStatistics{
+		Server:     server,
+		Players:    players,
+		Groups:     make(map[database.StatGroupName]map[string]*StatAggregate),
+		ComputedAt: time.Now(),
+	}
+
+	for _, result := range results {
+		aggregate := result.StatAggregate
+		if players > 0 {
+			aggregate.Average = aggregate.Sum / float64(players)
+		}
+
+		if _, ok := statistics.Groups[result.ID.Group]; !ok {
+			statistics.Groups[result.ID.Group] = make(map[string]*StatAggregate)
+		}
+
+		statistics.Groups[result.ID.Group][result.ID.Key] = &aggregate
+	}
+
+	statistics.Highlights = statistics.makeHighlights()
+	return statistics, nil
+}
+
+func (s *ServerStatistics) sumOf(groupName database.StatGroupName, key string) float64 {
+	if aggregate, ok := s.Groups[groupName][key]; ok {
+		return aggregate.Sum
+	}
+
+	return 0
+}
+
+func (s *ServerStatistics) averageOf(groupName database.StatGroupName, key string) float64 {
+	if aggregate, ok := s.Groups[groupName][key]; ok {
+		return aggregate.Average
+	}
+
+	return 0
+}
+
+// topOf returns the key with the largest sum in a group, ties are broken by key for stable output.
+func (s *ServerStatistics) topOf(groupName database.StatGroupName) *StatHighlight {
+	var top *StatHighlight
+
+	for key, aggregate := range s.Groups[groupName] {
+		if top == nil || aggregate.Sum > top.Value || (aggregate.Sum == top.Value && key < top.Key) {
+			top = &StatHighlight{Key: key, Value: aggregate.Sum}
+		}
+	}
+
+	return top
+}
+
+func (s *ServerStatistics) makeHighlights() ServerHighlights {
+	return ServerHighlights{
+		TotalBlocksMined:    s.sumOf(database.StatTotals, "bortexel:blocks_broken"),
+		TotalBlocksPlaced:   s.sumOf(database.StatTotals, "bortexel:blocks_placed"),
+		TotalPlayTime:       s.sumOf(database.StatTotals, "bortexel:play_time"),
+		AverageDeaths:       s.averageOf(database.StatTotals, "bortexel:deaths"),
+		AverageAdvancements: s.averageOf(database.StatTotals, "bortexel:advancements_done"),
+		AveragePlayTime:     s.averageOf(database.StatTotals, "bortexel:play_time"),
+		MostKilledMob:       s.topOf(database.StatKilled),
+		MostCraftedItem:     s.topOf(database.StatCrafted),
+		MostMinedBlock:      s.topOf(database.StatMined),
+		MostDeadlyEntity:    s.topOf(database.StatKilledBy),
+	}
+}
+
+func HandleServerStatistics(r *http.Request, body []byte) (any, error, int) {
+	var request ServerStatisticsRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	if request.Server.ServerName == "" {
+		return nil, errors.New("server is required"), http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationAggregate)
+	defer cancel()
+
+	statistics, err := ServerStatisticsCache.Load(ctx, request.Server)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if statistics.Players == 0 {
+		return nil, nil, http.StatusNotFound
+	}
+
+	return statistics, nil, http.StatusOK
+}
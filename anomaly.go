@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultAnomalyMinHours = 0.25
+
+	ticksPerHour           = 20 * 60 * 60
+	DefaultAnomalyPageSize = 100
+	MaxAnomalyPageSize     = 1000
+)
+
+type AnomalyRule struct {
+	Group database.StatGroupName
+	// Key may be "*" to match any key of the group
+	Key string
+	// Limit is the maximum growth of the stat per hour of play time
+	Limit float64
+}
+
+// defaultAnomalyRules allow per hour of play time at most that many of a stat, "*" matches any key of the group.
+var defaultAnomalyRules = []string{
+	"minecraft:mined/minecraft:diamond_ore=300",
+	"minecraft:mined/minecraft:deepslate_diamond_ore=300",
+	"minecraft:mined/minecraft:ancient_debris=100",
+	"minecraft:mined/*=20000",
+	"minecraft:killed/*=2000",
+}
+
+// ParseAnomalyRules parses rules like "minecraft:mined/minecraft:diamond_ore=300" or "minecraft:mined/*=20000".
+func ParseAnomalyRules(items []string) ([]AnomalyRule, error) {
+	rules := make([]AnomalyRule, 0, len(items))
+	for _, item := range items {
+		path, limit, found := strings.Cut(item, "=")
+		group, key, hasKey := strings.Cut(path, "/")
+		if !found || !hasKey || group == "" || key == "" {
+			return nil, errors.New("invalid anomaly rule " + item)
+		}
+
+		parsedLimit, err := strconv.ParseFloat(strings.TrimSpace(limit), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit of anomaly rule %s: %w", item, err)
+		}
+
+		rules = append(rules, AnomalyRule{Group: database.StatGroupName(group), Key: key, Limit: parsedLimit})
+	}
+
+	return rules, nil
+}
+
+// AnomalyConfig sets the rules of flagged updates. Short sessions count as MinHours of play time,
+// so a jump between two updates without play time in between can't divide by zero.
+type AnomalyConfig struct {
+	Rules    []string `yaml:"rules"`
+	MinHours float64  `yaml:"minHours"`
+}
+
+func DefaultAnomalyConfig() AnomalyConfig {
+	return AnomalyConfig{Rules: defaultAnomalyRules, MinHours: defaultAnomalyMinHours}
+}
+
+// applyEnv overrides the rules with ANOMALY_RULES and ANOMALY_MIN_HOURS.
+func (c *AnomalyConfig) applyEnv(env *envReader) {
+	c.Rules = env.List("ANOMALY_RULES", c.Rules)
+	c.MinHours = env.Float("ANOMALY_MIN_HOURS", c.MinHours)
+}
+
+func (c *AnomalyConfig) validate() []string {
+	problems := make([]string, 0)
+	if _, err := ParseAnomalyRules(c.Rules); err != nil {
+		problems = append(problems, "stats.anomalies.rules: "+err.Error())
+	}
+
+	if c.MinHours <= 0 {
+		problems = append(problems, "stats.anomalies.minHours must be positive")
+	}
+
+	return problems
+}
+
+// limitFor returns the most specific rule limit of a stat, exact keys win over wildcards.
+func limitFor(rules []AnomalyRule, groupName database.StatGroupName, key string) (float64, bool) {
+	limit, found := 0.0, false
+	for _, rule := range rules {
+		if rule.Group != groupName {
+			continue
+		}
+
+		if rule.Key == key {
+			return rule.Limit, true
+		}
+
+		if rule.Key == "*" && !found {
+			limit, found = rule.Limit, true
+		}
+	}
+
+	return limit, found
+}
+
+// DetectAnomalies returns deltas that grew faster than allowed per hour of play time, along with
+// the play time delta in ticks. Sessions shorter than minHours count as minHours.
+func DetectAnomalies(rules []AnomalyRule, minHours float64, previous database.StatsContainer, incoming database.StatsContainer) ([]*database.StatDelta, float64) {
+	playTimeDelta := math.Max(0, playTimeOf(incoming)-playTimeOf(previous))
+	hours := math.Max(playTimeDelta/ticksPerHour, minHours)
+
+	deltas := make([]*database.StatDelta, 0)
+	for groupName, stats := range incoming {
+		for key, value := range stats {
+			limit, ok := limitFor(rules, groupName, key)
+			if !ok {
+				continue
+			}
+
+			newValue, _ := database.NumericValue(value)
+			oldValue, _ := database.NumericValue(previous[groupName][key])
+			delta := newValue - oldValue
+			if rate := delta / hours; rate > limit {
+				deltas = append(deltas, &database.StatDelta{Group: groupName, Key: key, Delta: delta, Rate: rate, Limit: limit})
+			}
+		}
+	}
+
+	return deltas, playTimeDelta
+}
+
+// FlagAnomalies records a flag if the update grows stats suspiciously fast. Flags never block
+// updates, failing to record one is only logged.
+func FlagAnomalies(r *http.Request, request *UpdatePlayerRequest, previous database.StatsContainer) {
+	settings := CurrentSettings()
+	deltas, playTimeDelta := DetectAnomalies(settings.AnomalyRules, settings.Anomalies.MinHours, previous, request.Stats)
+	if len(deltas) == 0 {
+		return
+	}
+
+	flag := &database.AnomalyFlag{
+		Timestamp:     time.Now(),
+		Server:        request.Server.String(),
+		UUID:          request.UUID,
+		Name:          request.Name,
+		PlayTimeDelta: playTimeDelta,
+		Deltas:        deltas,
+	}
+
+	if key := RequestKey(r); key != nil {
+		flag.KeyName = key.Name
+	}
+
+	ctx, cancel := BackgroundContext(OperationWrite)
+	defer cancel()
+
+	RequestLog(r).Info("Anomaly flagged", "server", flag.Server, "uuid", flag.UUID, "name", flag.Name, "stats", len(deltas))
+	if err := database.InsertAnomalyFlag(ctx, flag); err != nil {
+		RequestLog(r).Error("Unable to record anomaly flag", "uuid", flag.UUID, "error", err)
+	}
+}
+
+type AnomalyFlagsRequest struct {
+	Server          ServerIdentifier `json:"server"`
+	UUID            string           `json:"uuid"`
+	IncludeReviewed bool             `json:"includeReviewed"`
+	Limit           int64            `json:"limit"`
+}
+
+func HandleAnomalyFlags(r *http.Request, body []byte) (any, error, int) {
+	var request AnomalyFlagsRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	if request.Limit == 0 {
+		request.Limit = DefaultAnomalyPageSize
+	}
+
+	if request.Limit < 0 || request.Limit > MaxAnomalyPageSize {
+		return nil, errors.New("invalid limit"), http.StatusUnprocessableEntity
+	}
+
+	query := database.AnomalyFlagQuery{
+		Servers:         requestedServers(r, request.Server),
+		UUID:            request.UUID,
+		IncludeReviewed: request.IncludeReviewed,
+		Limit:           request.Limit,
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	flags, err := database.FindAnomalyFlags(ctx, query)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return flags, nil, http.StatusOK
+}
+
+func HandleReviewAnomalyFlag(r *http.Request, body []byte) (any, error, int) {
+	var request struct {
+		ID primitive.ObjectID `json:"id"`
+	}
+
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationWrite)
+	defer cancel()
+
+	flag, err := database.FindAnomalyFlag(ctx, request.ID)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if flag == nil {
+		return nil, errors.New("flag not found"), http.StatusNotFound
+	}
+
+	if key := RequestKey(r); key != nil && !key.AllowsServer(flag.Server) {
+		return nil, errors.New("key is not allowed for server " + flag.Server), http.StatusForbidden
+	}
+
+	found, err := database.MarkAnomalyFlagReviewed(ctx, request.ID)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if !found {
+		return nil, errors.New("flag not found"), http.StatusNotFound
+	}
+
+	return nil, nil, http.StatusNoContent
+}
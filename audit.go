@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+const (
+	MaxAuditChanges      = 50
+	DefaultAuditPageSize = 100
+	MaxAuditPageSize     = 1000
+)
+
+// RequestAuditEntry returns the audit entry of an update request, so the action can describe its changes.
+func RequestAuditEntry(r *http.Request) *database.AuditEntry {
+	entry, _ := r.Context().Value(auditEntryContextKey).(*database.AuditEntry)
+	if entry == nil {
+		return &database.AuditEntry{}
+	}
+
+	return entry
+}
+
+// AuditUpdates records every call of an update action in the audit log. It expects the request
+// to be authorized already, see Authorization.
+func AuditUpdates(next ActionHandler) ActionHandler {
+	return func(r *http.Request, body []byte) (any, error, int) {
+		entry := &database.AuditEntry{
+			Timestamp: time.Now(),
+			SourceIP:  ClientIP(r),
+			Changes:   make([]*database.StatChange, 0),
+		}
+
+		if key := RequestKey(r); key != nil {
+			entry.KeyName = key.Name
+		}
+
+		var request struct {
+			Server ServerIdentifier `json:"server"`
+			UUID   string           `json:"uuid"`
+			Name   string           `json:"name"`
+		}
+
+		if json.Unmarshal(body, &request) == nil {
+			entry.Server = request.Server.String()
+			entry.UUID = request.UUID
+			entry.Name = request.Name
+		}
+
+		output, err, status := next(r.WithContext(context.WithValue(r.Context(), auditEntryContextKey, entry)), body)
+
+		entry.Status = status
+		if err != nil {
+			entry.Error = err.Error()
+		}
+
+		// The entry is written even if the client has gone away in the meantime
+		ctx, cancel := BackgroundContext(OperationWrite)
+		defer cancel()
+
+		if auditErr := database.InsertAuditEntry(ctx, entry); auditErr != nil {
+			RequestLog(r).Error("Unable to write audit entry", "server", entry.Server, "uuid", entry.UUID, "error", auditErr)
+		}
+
+		return output, err, status
+	}
+}
+
+// DescribeChanges fills the entry with the differences between stored and incoming stats.
+func DescribeChanges(entry *database.AuditEntry, previous *database.StoredPlayer, stats database.StatsContainer) {
+	if previous == nil {
+		entry.Created = true
+		previous = &database.StoredPlayer{}
+	} else if previous.Name != entry.Name {
+		entry.PreviousName = previous.Name
+	}
+
+	changes := make([]*database.StatChange, 0)
+	visit := func(groupName database.StatGroupName, key string) {
+		oldValue, _ := database.NumericValue(previous.Stats[groupName][key])
+		newValue, _ := database.NumericValue(stats[groupName][key])
+		if oldValue != newValue {
+			changes = append(changes, &database.StatChange{Group: groupName, Key: key, Old: oldValue, New: newValue})
+		}
+	}
+
+	for groupName, groupStats := range stats {
+		for key := range groupStats {
+			visit(groupName, key)
+		}
+	}
+
+	for groupName, groupStats := range previous.Stats {
+		for key := range groupStats {
+			if _, ok := stats[groupName][key]; !ok {
+				visit(groupName, key)
+			}
+		}
+	}
+
+	entry.ChangedFields = len(changes)
+	for _, change := range changes {
+		if change.New < change.Old {
+			entry.DecreasedStats++
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return math.Abs(changes[i].New-changes[i].Old) > math.Abs(changes[j].New-changes[j].Old)
+	})
+
+	if len(changes) > MaxAuditChanges {
+		changes = changes[:MaxAuditChanges]
+	}
+
+	entry.Changes = changes
+}
+
+type AuditLogRequest struct {
+	Server  ServerIdentifier `json:"server"`
+	UUID    string           `json:"uuid"`
+	KeyName string           `json:"keyName"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Limit   int64            `json:"limit"`
+}
+
+func HandleAuditLog(r *http.Request, body []byte) (any, error, int) {
+	var request AuditLogRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	if request.Limit == 0 {
+		request.Limit = DefaultAuditPageSize
+	}
+
+	if request.Limit < 0 || request.Limit > MaxAuditPageSize {
+		return nil, errors.New("invalid limit"), http.StatusUnprocessableEntity
+	}
+
+	query := database.AuditQuery{
+		UUID:    request.UUID,
+		Servers: requestedServers(r, request.Server),
+		KeyName: request.KeyName,
+		From:    request.From,
+		To:      request.To,
+		Limit:   request.Limit,
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	entries, err := database.FindAuditEntries(ctx, query)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return entries, nil, http.StatusOK
+}
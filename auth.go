@@ -1,20 +1,188 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"strings"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+var ErrUnauthorized = errors.New("unauthorized")
+
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	auditEntryContextKey
+	requestInfoContextKey
 )
 
-func Authorization(key string) func(handler ActionHandler) ActionHandler {
+// RequestKey returns the key that authenticated the request, if any.
+func RequestKey(r *http.Request) *database.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*database.APIKey)
+	return key
+}
+
+func withRequestKey(r *http.Request, key *database.APIKey) *http.Request {
+	if key != nil {
+		requestInfo(r).KeyName = key.Name
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key))
+}
+
+// Authenticate resolves the key from the Authorization header, it returns nil without an error if
+// the header is missing and ErrUnauthorized if the credentials are malformed or invalid.
+// Supported schemes are "Key <secret>", "Bearer <JWT>" and signatures, see AuthenticateSignature.
+func Authenticate(r *http.Request, body []byte) (*database.APIKey, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, nil
+	}
+
+	if IsSignedRequest(r) {
+		return AuthenticateSignature(r, body)
+	}
+
+	if token := strings.TrimPrefix(header, "Bearer "); token != header {
+		verifier := CurrentSettings().JWTVerifier
+		if verifier == nil || token == "" {
+			return nil, ErrUnauthorized
+		}
+
+		key, err := verifier.Verify(token)
+		if err != nil {
+			return nil, ErrUnauthorized
+		}
+
+		return key, nil
+	}
+
+	secret := strings.TrimPrefix(header, "Key ")
+	if secret == header || secret == "" {
+		return nil, ErrUnauthorized
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	key, err := LookupKey(ctx, secret)
+	if err == nil && key == nil {
+		return nil, ErrUnauthorized
+	}
+
+	return key, err
+}
+
+func authenticationError(r *http.Request, err error) (any, error, int) {
+	if err == ErrUnauthorized {
+		recordAuthenticationFailure(r, err)
+		return nil, err, http.StatusUnauthorized
+	}
+
+	return databaseError(err)
+}
+
+// requestServer extracts the target server of a request body, requests without a body or
+// without a server don't target any server and handlers check the records they act on.
+func requestServer(body []byte) (string, bool, error) {
+	if len(body) == 0 {
+		return "", false, nil
+	}
+
+	var request struct {
+		Server ServerIdentifier `json:"server"`
+	}
+
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		return "", false, err
+	}
+
+	if request.Server.ServerName == "" {
+		return "", false, nil
+	}
+
+	return request.Server.String(), true, nil
+}
+
+// requestedServers returns the servers a listing may include: the requested one, which Authorization
+// has already checked, or the servers of the key. Nil means every server.
+func requestedServers(r *http.Request, requested ServerIdentifier) []string {
+	if requested.ServerName != "" {
+		return []string{requested.String()}
+	}
+
+	if key := RequestKey(r); key != nil {
+		return key.ServerScope()
+	}
+
+	return nil
+}
+
+// Authorization only lets through requests with a key that has the scope and allows the requested server.
+func Authorization(scope string) func(handler ActionHandler) ActionHandler {
 	return func(next ActionHandler) ActionHandler {
 		return func(r *http.Request, body []byte) (any, error, int) {
-			header := r.Header.Get("Authorization")
-			if header != fmt.Sprintf("Key %s", key) {
-				return nil, errors.New("unauthorized"), http.StatusUnauthorized
+			if output, err, status := checkLockout(r); err != nil {
+				return output, err, status
 			}
 
-			return next(r, body)
+			if scope == ScopeUpdate && CurrentSettings().RequireSignedUpdates && !IsSignedRequest(r) {
+				return authenticationError(r, ErrUnauthorized)
+			}
+
+			key, err := Authenticate(r, body)
+			if err == nil && key == nil {
+				err = ErrUnauthorized
+			}
+
+			if err != nil {
+				return authenticationError(r, err)
+			}
+
+			if !key.HasScope(scope) {
+				logAuthorizationDenied(r, key, errors.New("missing scope "+scope))
+				return nil, errors.New("key is missing scope " + scope), http.StatusForbidden
+			}
+
+			server, ok, err := requestServer(body)
+			if err != nil {
+				return nil, err, http.StatusUnprocessableEntity
+			}
+
+			if ok && !key.AllowsServer(server) {
+				logAuthorizationDenied(r, key, errors.New("not allowed for server "+server))
+				return nil, errors.New("key is not allowed for server " + server), http.StatusForbidden
+			}
+
+			return next(withRequestKey(r, key), body)
 		}
 	}
 }
+
+// OptionalAuthentication lets anonymous requests through, but rejects invalid credentials and
+// makes the key of authenticated ones available through RequestKey for privileged reads.
+func OptionalAuthentication(next ActionHandler) ActionHandler {
+	return func(r *http.Request, body []byte) (any, error, int) {
+		if r.Header.Get("Authorization") != "" {
+			if output, err, status := checkLockout(r); err != nil {
+				return output, err, status
+			}
+		}
+
+		key, err := Authenticate(r, body)
+		if err != nil {
+			return authenticationError(r, err)
+		}
+
+		if key != nil {
+			r = withRequestKey(r, key)
+		}
+
+		return next(r, body)
+	}
+}
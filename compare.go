@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bortexel/stats-server/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const MaxComparedPlayers = 10
+
+type CompareRequest struct {
+	UUIDs   []string           `json:"uuids"`
+	Fields  []StatField        `json:"fields"`
+	Seasons []ServerIdentifier `json:"seasons"`
+}
+
+type ComparedPlayer struct {
+	UUID  string `json:"uuid"`
+	Name  string `json:"name"`
+	Found bool   `json:"found"`
+}
+
+type ComparedField struct {
+	Field StatField `json:"field"`
+	// Values are aligned with CompareResponse.Players
+	Values []float64 `json:"values"`
+	// Differences are relative to the first player
+	Differences []float64 `json:"differences"`
+	// Winner is empty when the best value is shared
+	Winner string `json:"winner"`
+}
+
+type CompareResponse struct {
+	Seasons []ServerIdentifier `json:"seasons"`
+	Players []*ComparedPlayer  `json:"players"`
+	Fields  []*ComparedField   `json:"fields"`
+}
+
+func (r CompareRequest) validate() error {
+	if len(r.UUIDs) < 2 {
+		return errors.New("at least two players are required")
+	}
+
+	if len(r.UUIDs) > MaxComparedPlayers {
+		return errors.New("too many players")
+	}
+
+	if len(r.Fields) == 0 {
+		return errors.New("at least one field is required")
+	}
+
+	for _, field := range r.Fields {
+		if field.GroupName == "" || field.FieldName == "" {
+			return errors.New("field group and name are required")
+		}
+	}
+
+	return nil
+}
+
+// comparedFieldKey names the sum of a compared field in the pipeline output, stat paths contain dots.
+func comparedFieldKey(index int) string {
+	return "f" + strconv.Itoa(index)
+}
+
+type comparedResult struct {
+	UUID   string     `bson:"_id"`
+	Latest latestName `bson:"latest"`
+	// Values are sums of the compared fields by comparedFieldKey
+	Values bson.M `bson:",inline"`
+}
+
+// makePipeline sums the compared fields of each requested player over the seasons. It only reads
+// documents of the requested players and returns one document per player.
+func (r CompareRequest) makePipeline(seasons []ServerIdentifier) mongo.Pipeline {
+	pipeline := unionSeasons(seasons, func(season ServerIdentifier) mongo.Pipeline {
+		projection := bson.D{{Key: "uuid", Value: 1}, {Key: "latest", Value: latestSeasonName(season)}}
+		for i, field := range r.Fields {
+			projection = append(projection, bson.E{Key: comparedFieldKey(i), Value: "$" + field.GetFullPath()})
+		}
+
+		return mongo.Pipeline{
+			{{Key: "$match", Value: bson.D{{Key: "uuid", Value: bson.M{"$in": r.UUIDs}}}}},
+			{{Key: "$project", Value: projection}},
+		}
+	})
+
+	group := bson.D{{Key: "_id", Value: "$uuid"}, {Key: "latest", Value: bson.M{"$max": "$latest"}}}
+	for i := range r.Fields {
+		group = append(group, bson.E{Key: comparedFieldKey(i), Value: bson.M{"$sum": "$" + comparedFieldKey(i)}})
+	}
+
+	return append(pipeline, bson.D{{Key: "$group", Value: group}})
+}
+
+func HandleComparePlayers(r *http.Request, body []byte) (any, error, int) {
+	var request CompareRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	err = request.validate()
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	seasons, err := resolveSeasons(ctx, request.Seasons)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if len(seasons) == 0 {
+		return nil, nil, http.StatusNotFound
+	}
+
+	cursor, err := database.Database.Collection(seasons[0].String()).Aggregate(ctx, request.makePipeline(seasons))
+	if err != nil {
+		return databaseError(err)
+	}
+
+	var results []*comparedResult
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	players := make(map[string]*ComparedPlayer)
+	values := make(map[string]bson.M)
+	for _, result := range results {
+		players[result.UUID] = &ComparedPlayer{UUID: result.UUID, Name: result.Latest.Name, Found: true}
+		values[result.UUID] = result.Values
+	}
+
+	if len(players) == 0 {
+		return nil, nil, http.StatusNotFound
+	}
+
+	response := &CompareResponse{
+		Seasons: seasons,
+		Players: make([]*ComparedPlayer, 0, len(request.UUIDs)),
+		Fields:  make([]*ComparedField, 0, len(request.Fields)),
+	}
+
+	for _, uuid := range request.UUIDs {
+		player, ok := players[uuid]
+		if !ok {
+			player = &ComparedPlayer{UUID: uuid}
+		}
+
+		response.Players = append(response.Players, player)
+	}
+
+	for index, field := range request.Fields {
+		compared := &ComparedField{
+			Field:       field,
+			Values:      make([]float64, 0, len(request.UUIDs)),
+			Differences: make([]float64, 0, len(request.UUIDs)),
+		}
+
+		var best float64
+		var bestCount int
+		for i, uuid := range request.UUIDs {
+			value, _ := database.NumericValue(values[uuid][comparedFieldKey(index)])
+			compared.Values = append(compared.Values, value)
+			compared.Differences = append(compared.Differences, value-compared.Values[0])
+
+			switch {
+			case i == 0 || value > best:
+				best, bestCount = value, 1
+				compared.Winner = uuid
+			case value == best:
+				bestCount++
+			}
+		}
+
+		if bestCount > 1 {
+			compared.Winner = ""
+		}
+
+		response.Fields = append(response.Fields, compared)
+	}
+
+	return response, nil, http.StatusOK
+}
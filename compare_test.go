@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// unionedSeasons returns collections of the $unionWith stages of a pipeline.
+func unionedSeasons(pipeline []bson.D) []string {
+	collections := make([]string, 0)
+	for _, stage := range pipeline {
+		if stage[0].Key == "$unionWith" {
+			collections = append(collections, stage[0].Value.(bson.M)["coll"].(string))
+		}
+	}
+
+	return collections
+}
+
+func TestCompareCountsDuplicatedSeasonsOnce(t *testing.T) {
+	request := CompareRequest{
+		UUIDs:   []string{"a", "b"},
+		Fields:  []StatField{{GroupName: "minecraft:custom", FieldName: "minecraft:deaths"}},
+		Seasons: []ServerIdentifier{{"survival", 5}, {"survival", 5}, {"survival", 4}, {"survival", 5}},
+	}
+
+	existing := []ServerIdentifier{{"survival", 4}, {"survival", 5}}
+	pipeline := request.makePipeline(selectSeasons(request.Seasons, existing))
+
+	// The first season is the collection the pipeline runs on, every other one is unioned once
+	unioned := unionedSeasons(pipeline)
+	if len(unioned) != 1 || unioned[0] != "survival_4" {
+		t.Fatalf("expected only survival_4 to be unioned, got %v", unioned)
+	}
+}
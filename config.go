@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultBindAddr          = ":8080"
+	defaultMetricsBindAddr   = ":9090"
+	defaultDatabaseName      = "stats"
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 15 * time.Second
+	defaultWriteTimeout      = 45 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 25 * time.Second
+)
+
+// Config is read from a YAML file, see LoadConfig. Environment variables override the file,
+// so existing deployments configured only through the environment keep working.
+type Config struct {
+	Storage StorageConfig     `yaml:"storage"`
+	HTTP    HTTPConfig        `yaml:"http"`
+	Auth    AuthConfig        `yaml:"auth"`
+	CORS    CORSPolicy        `yaml:"cors"`
+	Limits  LimitsConfig      `yaml:"limits"`
+	Logging LoggingConfig     `yaml:"logging"`
+	Tracing TracingConfig     `yaml:"tracing"`
+	Stats   StatsConfig       `yaml:"stats"`
+	Reload  ReloadingConfig   `yaml:"reload"`
+	Seasons []SeasonConfig    `yaml:"seasons"`
+	Totals  []TotalRule       `yaml:"totals"`
+	Indexes []StatIndexConfig `yaml:"indexes"`
+}
+
+type StorageConfig struct {
+	URI      string            `yaml:"uri"`
+	Database string            `yaml:"database"`
+	Timeouts OperationTimeouts `yaml:"timeouts"`
+	// AggregateCacheTTL is how long computed server statistics are served before they are computed again
+	AggregateCacheTTL time.Duration `yaml:"aggregateCacheTTL"`
+}
+
+type HTTPConfig struct {
+	BindAddr string `yaml:"bindAddr"`
+	// MetricsBindAddr serves /metrics apart from the API, without authentication or rate limits,
+	// so it must not be reachable publicly. Metrics are disabled if it's empty.
+	MetricsBindAddr   string        `yaml:"metricsBindAddr"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"`
+	// TrustProxyHeaders takes client addresses from X-Forwarded-For, only enable it behind a proxy
+	TrustProxyHeaders bool `yaml:"trustProxyHeaders"`
+	// ProxyHops is the number of our proxies in front of the server, each of them appends an entry
+	ProxyHops int `yaml:"proxyHops"`
+}
+
+type AuthConfig struct {
+	// MutationKey predates the key store, it may update every server
+	MutationKey string `yaml:"mutationKey"`
+	// LimitExpansionKey is deprecated in favor of keys with the limit expansion scope
+	LimitExpansionKey    string      `yaml:"limitExpansionKey"`
+	RequireSignedUpdates bool        `yaml:"requireSignedUpdates"`
+	Keys                 []KeyConfig `yaml:"keys"`
+	// SignatureMaxAge is how far the timestamp of a signed request may be from the server clock
+	SignatureMaxAge time.Duration `yaml:"signatureMaxAge"`
+	Lockout         LockoutConfig `yaml:"lockout"`
+	JWT             JWTConfig     `yaml:"jwt"`
+}
+
+// APIKeys returns every key defined in the configuration.
+func (c AuthConfig) APIKeys() []*database.APIKey {
+	keys := make([]*database.APIKey, 0, len(c.Keys)+1)
+	if c.MutationKey != "" {
+		keys = append(keys, KeyConfig{Name: "MUTATION_KEY", Secret: c.MutationKey, Servers: []string{"*"}, Scopes: []string{ScopeUpdate}}.APIKey())
+	}
+
+	for _, key := range c.Keys {
+		keys = append(keys, key.APIKey())
+	}
+
+	return keys
+}
+
+// StatsConfig decides what happens to suspicious updates.
+type StatsConfig struct {
+	// UnknownKeys applies to stats that are well-formed, but missing in registries.
+	// Malformed stats with bad groups, keys or values are never stored.
+	UnknownKeys UnknownStatsPolicy `yaml:"unknownKeys"`
+	Regression  RegressionConfig   `yaml:"regression"`
+	Anomalies   AnomalyConfig      `yaml:"anomalies"`
+}
+
+func DefaultStatsConfig() StatsConfig {
+	return StatsConfig{
+		// Registries lag behind the game, quarantining by default would strip stats of newer versions
+		UnknownKeys: UnknownStatsAllow,
+		Regression:  DefaultRegressionConfig(),
+		Anomalies:   DefaultAnomalyConfig(),
+	}
+}
+
+func (c *StatsConfig) applyEnv(env *envReader) {
+	c.UnknownKeys = UnknownStatsPolicy(env.String("STATS_UNKNOWN_KEYS", string(c.UnknownKeys)))
+	c.Regression.applyEnv(env)
+	c.Anomalies.applyEnv(env)
+}
+
+func (c *StatsConfig) validate() []string {
+	problems := make([]string, 0)
+	if _, err := ParseUnknownStatsPolicy(string(c.UnknownKeys)); err != nil {
+		problems = append(problems, "stats.unknownKeys: "+err.Error())
+	}
+
+	problems = append(problems, c.Regression.validate()...)
+	problems = append(problems, c.Anomalies.validate()...)
+	return problems
+}
+
+type LimitsConfig struct {
+	MaxRecords int64           `yaml:"maxRecords"`
+	RateLimit  RateLimitConfig `yaml:"rateLimit"`
+}
+
+// ConfigError lists every problem of a configuration, so they can be fixed at once.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Storage: StorageConfig{
+			Database:          defaultDatabaseName,
+			Timeouts:          DefaultOperationTimeouts(),
+			AggregateCacheTTL: defaultAggregateCacheTTL,
+		},
+		HTTP: HTTPConfig{
+			BindAddr:          defaultBindAddr,
+			MetricsBindAddr:   defaultMetricsBindAddr,
+			ReadHeaderTimeout: defaultReadHeaderTimeout,
+			ReadTimeout:       defaultReadTimeout,
+			WriteTimeout:      defaultWriteTimeout,
+			IdleTimeout:       defaultIdleTimeout,
+			ShutdownTimeout:   defaultShutdownTimeout,
+			ProxyHops:         1,
+		},
+		Auth: AuthConfig{
+			SignatureMaxAge: defaultSignatureMaxAge,
+			Lockout:         DefaultLockoutConfig(),
+			JWT:             DefaultJWTConfig(),
+		},
+		CORS:    DefaultCORSPolicy(),
+		Limits:  LimitsConfig{MaxRecords: defaultMaxRecords, RateLimit: DefaultRateLimitConfig()},
+		Logging: DefaultLoggingConfig(),
+		Tracing: DefaultTracingConfig(),
+		Stats:   DefaultStatsConfig(),
+		Reload:  DefaultReloadingConfig(),
+		Seasons: make([]SeasonConfig, 0),
+		Totals:  DefaultTotalRules(),
+		Indexes: make([]StatIndexConfig, 0),
+	}
+}
+
+// LoadConfig reads the file on top of the defaults, an empty path means there is no file.
+// Unknown fields are rejected, they are most likely typos.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("unable to parse %s: %w", path, err)
+		}
+	}
+
+	env := &envReader{}
+	config.applyEnv(env)
+	problems := env.problems
+	var configErr *ConfigError
+	if err := config.Validate(); errors.As(err, &configErr) {
+		problems = append(problems, configErr.Problems...)
+	}
+
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+
+	return config, nil
+}
+
+func (c *Config) applyEnv(env *envReader) {
+	c.Storage.URI = env.String("MONGO_CONNECTION_URI", c.Storage.URI)
+	c.Storage.Database = env.String("MONGO_DATABASE", c.Storage.Database)
+	c.Storage.Timeouts.applyEnv(env)
+	c.Storage.AggregateCacheTTL = env.Duration("AGGREGATE_CACHE_TTL", c.Storage.AggregateCacheTTL)
+
+	c.HTTP.BindAddr = env.String("BIND_ADDR", c.HTTP.BindAddr)
+	c.HTTP.MetricsBindAddr = env.String("METRICS_BIND_ADDR", c.HTTP.MetricsBindAddr)
+	c.HTTP.ReadHeaderTimeout = env.Duration("HTTP_READ_HEADER_TIMEOUT", c.HTTP.ReadHeaderTimeout)
+	c.HTTP.ReadTimeout = env.Duration("HTTP_READ_TIMEOUT", c.HTTP.ReadTimeout)
+	c.HTTP.WriteTimeout = env.Duration("HTTP_WRITE_TIMEOUT", c.HTTP.WriteTimeout)
+	c.HTTP.IdleTimeout = env.Duration("HTTP_IDLE_TIMEOUT", c.HTTP.IdleTimeout)
+	c.HTTP.ShutdownTimeout = env.Duration("SHUTDOWN_TIMEOUT", c.HTTP.ShutdownTimeout)
+	c.HTTP.TrustProxyHeaders = env.Bool("TRUST_PROXY_HEADERS", c.HTTP.TrustProxyHeaders)
+	c.HTTP.ProxyHops = env.Int("PROXY_HOPS", c.HTTP.ProxyHops)
+
+	c.Auth.MutationKey = env.String("MUTATION_KEY", c.Auth.MutationKey)
+	c.Auth.LimitExpansionKey = env.String("LIMIT_EXPANSION_KEY", c.Auth.LimitExpansionKey)
+	c.Auth.RequireSignedUpdates = env.Bool("REQUIRE_SIGNED_UPDATES", c.Auth.RequireSignedUpdates)
+	c.Auth.SignatureMaxAge = env.Duration("SIGNATURE_MAX_AGE", c.Auth.SignatureMaxAge)
+	c.Auth.Lockout.applyEnv(env)
+	c.Auth.JWT.applyEnv(env)
+
+	c.CORS.applyEnv(env)
+	c.Limits.MaxRecords = int64(env.Int("MAX_RECORDS", int(c.Limits.MaxRecords)))
+	c.Limits.RateLimit.applyEnv(env)
+	c.Logging.applyEnv(env)
+	c.Tracing.applyEnv(env)
+	c.Stats.applyEnv(env)
+	c.Reload.applyEnv(env)
+}
+
+// Validate checks the configuration without connecting anywhere.
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	if c.Storage.URI == "" {
+		problems = append(problems, "storage.uri is required, set it or MONGO_CONNECTION_URI")
+	}
+
+	if c.Storage.Database == "" {
+		problems = append(problems, "storage.database must not be empty")
+	}
+
+	problems = append(problems, c.Storage.Timeouts.validate()...)
+	if c.Storage.AggregateCacheTTL < 0 {
+		problems = append(problems, "storage.aggregateCacheTTL must not be negative")
+	}
+
+	if c.HTTP.BindAddr == "" {
+		problems = append(problems, "http.bindAddr must not be empty")
+	}
+
+	if c.HTTP.MetricsBindAddr != "" && c.HTTP.MetricsBindAddr == c.HTTP.BindAddr {
+		problems = append(problems, "http.metricsBindAddr must differ from http.bindAddr")
+	}
+
+	if c.HTTP.ReadHeaderTimeout < 0 || c.HTTP.ReadTimeout < 0 || c.HTTP.WriteTimeout < 0 ||
+		c.HTTP.IdleTimeout < 0 || c.HTTP.ShutdownTimeout < 0 {
+		problems = append(problems, "http timeouts must not be negative")
+	}
+
+	// Requests reaching an operation deadline are answered with 504, which can't be written
+	// once the write timeout of the connection has passed. Zero disables the write timeout.
+	if longest := c.Storage.Timeouts.Longest(); c.HTTP.WriteTimeout > 0 && c.HTTP.WriteTimeout <= longest {
+		problems = append(problems, fmt.Sprintf("http.writeTimeout must be longer than the longest storage timeout (%s)", longest))
+	}
+
+	if c.HTTP.TrustProxyHeaders && c.HTTP.ProxyHops < 1 {
+		problems = append(problems, "http.proxyHops must be positive with http.trustProxyHeaders")
+	}
+
+	names := make(map[string]bool)
+	for i, key := range c.Auth.Keys {
+		path := fmt.Sprintf("auth.keys[%d]", i)
+		problems = append(problems, key.validate(path)...)
+		if names[key.Name] || (key.Name == "MUTATION_KEY" && c.Auth.MutationKey != "") {
+			problems = append(problems, path+": duplicate name "+key.Name)
+		}
+
+		names[key.Name] = true
+	}
+
+	if c.Auth.SignatureMaxAge <= 0 {
+		problems = append(problems, "auth.signatureMaxAge must be positive")
+	}
+
+	problems = append(problems, c.Auth.Lockout.validate()...)
+	problems = append(problems, c.Auth.JWT.validate()...)
+
+	problems = append(problems, c.CORS.validate()...)
+	if c.Limits.MaxRecords < 1 {
+		problems = append(problems, "limits.maxRecords must be positive")
+	}
+
+	problems = append(problems, c.Limits.RateLimit.validate()...)
+	problems = append(problems, c.Logging.validate()...)
+	problems = append(problems, c.Tracing.validate()...)
+	problems = append(problems, c.Stats.validate()...)
+	problems = append(problems, c.Reload.validate()...)
+	problems = append(problems, validateSeasons(c.Seasons)...)
+	problems = append(problems, validateTotalRules(c.Totals)...)
+	problems = append(problems, validateStatIndexes(c.Indexes)...)
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+
+	return nil
+}
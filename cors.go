@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCORSAllowedMethods = "GET, POST, PATCH"
+	defaultCORSAllowedHeaders = "Content-Type, Authorization, X-Signature-Timestamp, X-Signature-Nonce"
+)
+
+type CORSPolicy struct {
+	// AllowedOrigins may contain "*" to allow any origin
+	AllowedOrigins   []string `yaml:"allowedOrigins"`
+	AllowedMethods   []string `yaml:"allowedMethods"`
+	AllowedHeaders   []string `yaml:"allowedHeaders"`
+	AllowCredentials bool     `yaml:"allowCredentials"`
+	MaxAge           int      `yaml:"maxAge"`
+}
+
+// DefaultCORSPolicy lets any origin call the API.
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: splitList(defaultCORSAllowedMethods),
+		AllowedHeaders: splitList(defaultCORSAllowedHeaders),
+	}
+}
+
+// applyEnv overrides the policy with CORS_* variables.
+func (p *CORSPolicy) applyEnv(env *envReader) {
+	p.AllowedOrigins = env.List("CORS_ALLOWED_ORIGINS", p.AllowedOrigins)
+	p.AllowedMethods = env.List("CORS_ALLOWED_METHODS", p.AllowedMethods)
+	p.AllowedHeaders = env.List("CORS_ALLOWED_HEADERS", p.AllowedHeaders)
+	p.AllowCredentials = env.Bool("CORS_ALLOW_CREDENTIALS", p.AllowCredentials)
+	p.MaxAge = env.Int("CORS_MAX_AGE", p.MaxAge)
+}
+
+func (p *CORSPolicy) validate() []string {
+	problems := make([]string, 0)
+	if len(p.AllowedMethods) == 0 {
+		problems = append(problems, "cors.allowedMethods must not be empty")
+	}
+
+	if p.MaxAge < 0 {
+		problems = append(problems, "cors.maxAge must not be negative")
+	}
+
+	// Apply would echo every origin with credentials, letting any website make credentialed reads
+	if p.AllowCredentials && p.allowsAnyOrigin() {
+		problems = append(problems, "cors.allowCredentials requires explicit cors.allowedOrigins instead of *")
+	}
+
+	return problems
+}
+
+func (p *CORSPolicy) allowsAnyOrigin() bool {
+	return containsFold(p.AllowedOrigins, "*")
+}
+
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	return p.allowsAnyOrigin() || containsFold(p.AllowedOrigins, origin)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, current := range values {
+		if strings.EqualFold(current, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply sets CORS headers of the response. For preflight requests it writes the whole response and
+// returns true, so they never reach actions.
+func (p *CORSPolicy) Apply(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+	if !p.allowsAnyOrigin() || p.AllowCredentials {
+		w.Header().Add("Vary", "Origin")
+	}
+
+	if origin == "" || !p.allowsOrigin(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+		}
+
+		return preflight
+	}
+
+	// Credentials can't be used with the wildcard, so the origin is echoed back instead
+	if p.allowsAnyOrigin() && !p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if p.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, "+RequestIDHeader)
+		return false
+	}
+
+	if !containsFold(p.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+	w.Header().Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+	if p.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(p.MaxAge))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -1,4 +1,4 @@
-// This file was generated by blocks_gen.go. Any changes will be lost.
+// This file was generated by registries_gen.go. Any changes will be lost.
 
 package data
 
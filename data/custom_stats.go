@@ -0,0 +1,92 @@
+package data
+
+// customStats are the keys of the minecraft:custom stat group. Unlike blocks they aren't part of
+// the generated data, so new ones have to be added here when the game adds them.
+var customStats = []string{
+	"minecraft:animals_bred",
+	"minecraft:aviate_one_cm",
+	"minecraft:bell_ring",
+	"minecraft:boat_one_cm",
+	"minecraft:clean_armor",
+	"minecraft:clean_banner",
+	"minecraft:clean_shulker_box",
+	"minecraft:climb_one_cm",
+	"minecraft:crouch_one_cm",
+	"minecraft:damage_absorbed",
+	"minecraft:damage_blocked_by_shield",
+	"minecraft:damage_dealt",
+	"minecraft:damage_dealt_absorbed",
+	"minecraft:damage_dealt_resisted",
+	"minecraft:damage_resisted",
+	"minecraft:damage_taken",
+	"minecraft:deaths",
+	"minecraft:drop",
+	"minecraft:eat_cake_slice",
+	"minecraft:enchant_item",
+	"minecraft:fall_one_cm",
+	"minecraft:fill_cauldron",
+	"minecraft:fish_caught",
+	"minecraft:fly_one_cm",
+	"minecraft:horse_one_cm",
+	"minecraft:inspect_dispenser",
+	"minecraft:inspect_dropper",
+	"minecraft:inspect_hopper",
+	"minecraft:interact_with_anvil",
+	"minecraft:interact_with_beacon",
+	"minecraft:interact_with_blast_furnace",
+	"minecraft:interact_with_brewingstand",
+	"minecraft:interact_with_campfire",
+	"minecraft:interact_with_cartography_table",
+	"minecraft:interact_with_crafting_table",
+	"minecraft:interact_with_furnace",
+	"minecraft:interact_with_grindstone",
+	"minecraft:interact_with_lectern",
+	"minecraft:interact_with_loom",
+	"minecraft:interact_with_smithing_table",
+	"minecraft:interact_with_smoker",
+	"minecraft:interact_with_stonecutter",
+	"minecraft:jump",
+	"minecraft:leave_game",
+	"minecraft:minecart_one_cm",
+	"minecraft:mob_kills",
+	"minecraft:open_barrel",
+	"minecraft:open_chest",
+	"minecraft:open_enderchest",
+	"minecraft:open_shulker_box",
+	"minecraft:pig_one_cm",
+	"minecraft:play_noteblock",
+	"minecraft:play_one_minute", // Renamed to play_time in 1.17
+	"minecraft:play_record",
+	"minecraft:play_time",
+	"minecraft:player_kills",
+	"minecraft:pot_flower",
+	"minecraft:raid_trigger",
+	"minecraft:raid_win",
+	"minecraft:sleep_in_bed",
+	"minecraft:sneak_time",
+	"minecraft:sprint_one_cm",
+	"minecraft:strider_one_cm",
+	"minecraft:swim_one_cm",
+	"minecraft:talked_to_villager",
+	"minecraft:target_hit",
+	"minecraft:time_since_death",
+	"minecraft:time_since_rest",
+	"minecraft:total_world_time",
+	"minecraft:traded_with_villager",
+	"minecraft:trigger_trapped_chest",
+	"minecraft:tune_noteblock",
+	"minecraft:use_cauldron",
+	"minecraft:walk_on_water_one_cm",
+	"minecraft:walk_one_cm",
+	"minecraft:walk_under_water_one_cm",
+}
+
+func IsCustomStat(id string) bool {
+	for _, currentID := range customStats {
+		if currentID == id {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,371 @@
+package data
+
+// nonBlockItems are items without a block of the same ID, block items come from the block registry.
+// This list stands in for the item registry until `go generate ./generators` replaces this file with
+// the one of MinecraftVersion, unknown stats are allowed by default until then.
+var nonBlockItems = []string{
+	"minecraft:wooden_sword",
+	"minecraft:wooden_shovel",
+	"minecraft:wooden_pickaxe",
+	"minecraft:wooden_axe",
+	"minecraft:wooden_hoe",
+	"minecraft:stone_sword",
+	"minecraft:stone_shovel",
+	"minecraft:stone_pickaxe",
+	"minecraft:stone_axe",
+	"minecraft:stone_hoe",
+	"minecraft:iron_sword",
+	"minecraft:iron_shovel",
+	"minecraft:iron_pickaxe",
+	"minecraft:iron_axe",
+	"minecraft:iron_hoe",
+	"minecraft:golden_sword",
+	"minecraft:golden_shovel",
+	"minecraft:golden_pickaxe",
+	"minecraft:golden_axe",
+	"minecraft:golden_hoe",
+	"minecraft:diamond_sword",
+	"minecraft:diamond_shovel",
+	"minecraft:diamond_pickaxe",
+	"minecraft:diamond_axe",
+	"minecraft:diamond_hoe",
+	"minecraft:netherite_sword",
+	"minecraft:netherite_shovel",
+	"minecraft:netherite_pickaxe",
+	"minecraft:netherite_axe",
+	"minecraft:netherite_hoe",
+	"minecraft:leather_helmet",
+	"minecraft:leather_chestplate",
+	"minecraft:leather_leggings",
+	"minecraft:leather_boots",
+	"minecraft:chainmail_helmet",
+	"minecraft:chainmail_chestplate",
+	"minecraft:chainmail_leggings",
+	"minecraft:chainmail_boots",
+	"minecraft:iron_helmet",
+	"minecraft:iron_chestplate",
+	"minecraft:iron_leggings",
+	"minecraft:iron_boots",
+	"minecraft:golden_helmet",
+	"minecraft:golden_chestplate",
+	"minecraft:golden_leggings",
+	"minecraft:golden_boots",
+	"minecraft:diamond_helmet",
+	"minecraft:diamond_chestplate",
+	"minecraft:diamond_leggings",
+	"minecraft:diamond_boots",
+	"minecraft:netherite_helmet",
+	"minecraft:netherite_chestplate",
+	"minecraft:netherite_leggings",
+	"minecraft:netherite_boots",
+	"minecraft:turtle_helmet",
+	"minecraft:elytra",
+	"minecraft:leather_horse_armor",
+	"minecraft:iron_horse_armor",
+	"minecraft:golden_horse_armor",
+	"minecraft:diamond_horse_armor",
+	"minecraft:saddle",
+	"minecraft:bow",
+	"minecraft:crossbow",
+	"minecraft:trident",
+	"minecraft:shield",
+	"minecraft:arrow",
+	"minecraft:spectral_arrow",
+	"minecraft:tipped_arrow",
+	"minecraft:fishing_rod",
+	"minecraft:flint_and_steel",
+	"minecraft:shears",
+	"minecraft:carrot_on_a_stick",
+	"minecraft:warped_fungus_on_a_stick",
+	"minecraft:spyglass",
+	"minecraft:lead",
+	"minecraft:name_tag",
+	"minecraft:compass",
+	"minecraft:recovery_compass",
+	"minecraft:clock",
+	"minecraft:bundle",
+	"minecraft:goat_horn",
+	"minecraft:bucket",
+	"minecraft:water_bucket",
+	"minecraft:lava_bucket",
+	"minecraft:milk_bucket",
+	"minecraft:powder_snow_bucket",
+	"minecraft:pufferfish_bucket",
+	"minecraft:salmon_bucket",
+	"minecraft:cod_bucket",
+	"minecraft:tropical_fish_bucket",
+	"minecraft:axolotl_bucket",
+	"minecraft:tadpole_bucket",
+	"minecraft:coal",
+	"minecraft:charcoal",
+	"minecraft:diamond",
+	"minecraft:emerald",
+	"minecraft:lapis_lazuli",
+	"minecraft:quartz",
+	"minecraft:amethyst_shard",
+	"minecraft:raw_iron",
+	"minecraft:raw_copper",
+	"minecraft:raw_gold",
+	"minecraft:iron_ingot",
+	"minecraft:copper_ingot",
+	"minecraft:gold_ingot",
+	"minecraft:netherite_ingot",
+	"minecraft:netherite_scrap",
+	"minecraft:iron_nugget",
+	"minecraft:gold_nugget",
+	"minecraft:stick",
+	"minecraft:bowl",
+	"minecraft:string",
+	"minecraft:feather",
+	"minecraft:gunpowder",
+	"minecraft:wheat_seeds",
+	"minecraft:pumpkin_seeds",
+	"minecraft:melon_seeds",
+	"minecraft:beetroot_seeds",
+	"minecraft:flint",
+	"minecraft:leather",
+	"minecraft:rabbit_hide",
+	"minecraft:scute",
+	"minecraft:brick",
+	"minecraft:nether_brick",
+	"minecraft:clay_ball",
+	"minecraft:paper",
+	"minecraft:book",
+	"minecraft:slime_ball",
+	"minecraft:egg",
+	"minecraft:glowstone_dust",
+	"minecraft:ink_sac",
+	"minecraft:glow_ink_sac",
+	"minecraft:cocoa_beans",
+	"minecraft:bone_meal",
+	"minecraft:bone",
+	"minecraft:sugar",
+	"minecraft:blaze_rod",
+	"minecraft:blaze_powder",
+	"minecraft:ghast_tear",
+	"minecraft:ender_pearl",
+	"minecraft:ender_eye",
+	"minecraft:magma_cream",
+	"minecraft:fermented_spider_eye",
+	"minecraft:spider_eye",
+	"minecraft:glistering_melon_slice",
+	"minecraft:prismarine_shard",
+	"minecraft:prismarine_crystals",
+	"minecraft:rabbit_foot",
+	"minecraft:nautilus_shell",
+	"minecraft:heart_of_the_sea",
+	"minecraft:phantom_membrane",
+	"minecraft:shulker_shell",
+	"minecraft:popped_chorus_fruit",
+	"minecraft:dragon_breath",
+	"minecraft:experience_bottle",
+	"minecraft:fire_charge",
+	"minecraft:firework_rocket",
+	"minecraft:firework_star",
+	"minecraft:honeycomb",
+	"minecraft:echo_shard",
+	"minecraft:disc_fragment_5",
+	"minecraft:nether_star",
+	"minecraft:totem_of_undying",
+	"minecraft:redstone",
+	"minecraft:snowball",
+	"minecraft:white_dye",
+	"minecraft:orange_dye",
+	"minecraft:magenta_dye",
+	"minecraft:light_blue_dye",
+	"minecraft:yellow_dye",
+	"minecraft:lime_dye",
+	"minecraft:pink_dye",
+	"minecraft:gray_dye",
+	"minecraft:light_gray_dye",
+	"minecraft:cyan_dye",
+	"minecraft:purple_dye",
+	"minecraft:blue_dye",
+	"minecraft:brown_dye",
+	"minecraft:green_dye",
+	"minecraft:red_dye",
+	"minecraft:black_dye",
+	"minecraft:map",
+	"minecraft:filled_map",
+	"minecraft:writable_book",
+	"minecraft:written_book",
+	"minecraft:enchanted_book",
+	"minecraft:knowledge_book",
+	"minecraft:debug_stick",
+	"minecraft:glass_bottle",
+	"minecraft:potion",
+	"minecraft:splash_potion",
+	"minecraft:lingering_potion",
+	"minecraft:honey_bottle",
+	"minecraft:armor_stand",
+	"minecraft:item_frame",
+	"minecraft:glow_item_frame",
+	"minecraft:painting",
+	"minecraft:end_crystal",
+	"minecraft:minecart",
+	"minecraft:chest_minecart",
+	"minecraft:furnace_minecart",
+	"minecraft:tnt_minecart",
+	"minecraft:hopper_minecart",
+	"minecraft:command_block_minecart",
+	"minecraft:oak_boat",
+	"minecraft:oak_chest_boat",
+	"minecraft:spruce_boat",
+	"minecraft:spruce_chest_boat",
+	"minecraft:birch_boat",
+	"minecraft:birch_chest_boat",
+	"minecraft:jungle_boat",
+	"minecraft:jungle_chest_boat",
+	"minecraft:acacia_boat",
+	"minecraft:acacia_chest_boat",
+	"minecraft:dark_oak_boat",
+	"minecraft:dark_oak_chest_boat",
+	"minecraft:mangrove_boat",
+	"minecraft:mangrove_chest_boat",
+	"minecraft:flower_banner_pattern",
+	"minecraft:creeper_banner_pattern",
+	"minecraft:skull_banner_pattern",
+	"minecraft:mojang_banner_pattern",
+	"minecraft:globe_banner_pattern",
+	"minecraft:piglin_banner_pattern",
+	"minecraft:apple",
+	"minecraft:golden_apple",
+	"minecraft:enchanted_golden_apple",
+	"minecraft:mushroom_stew",
+	"minecraft:bread",
+	"minecraft:porkchop",
+	"minecraft:cooked_porkchop",
+	"minecraft:cod",
+	"minecraft:salmon",
+	"minecraft:tropical_fish",
+	"minecraft:pufferfish",
+	"minecraft:cooked_cod",
+	"minecraft:cooked_salmon",
+	"minecraft:cookie",
+	"minecraft:melon_slice",
+	"minecraft:dried_kelp",
+	"minecraft:beef",
+	"minecraft:cooked_beef",
+	"minecraft:chicken",
+	"minecraft:cooked_chicken",
+	"minecraft:rotten_flesh",
+	"minecraft:carrot",
+	"minecraft:golden_carrot",
+	"minecraft:potato",
+	"minecraft:baked_potato",
+	"minecraft:poisonous_potato",
+	"minecraft:pumpkin_pie",
+	"minecraft:rabbit",
+	"minecraft:cooked_rabbit",
+	"minecraft:rabbit_stew",
+	"minecraft:mutton",
+	"minecraft:cooked_mutton",
+	"minecraft:beetroot",
+	"minecraft:beetroot_soup",
+	"minecraft:suspicious_stew",
+	"minecraft:sweet_berries",
+	"minecraft:glow_berries",
+	"minecraft:chorus_fruit",
+	"minecraft:music_disc_13",
+	"minecraft:music_disc_cat",
+	"minecraft:music_disc_blocks",
+	"minecraft:music_disc_chirp",
+	"minecraft:music_disc_far",
+	"minecraft:music_disc_mall",
+	"minecraft:music_disc_mellohi",
+	"minecraft:music_disc_stal",
+	"minecraft:music_disc_strad",
+	"minecraft:music_disc_ward",
+	"minecraft:music_disc_11",
+	"minecraft:music_disc_wait",
+	"minecraft:music_disc_otherside",
+	"minecraft:music_disc_5",
+	"minecraft:music_disc_pigstep",
+	"minecraft:allay_spawn_egg",
+	"minecraft:axolotl_spawn_egg",
+	"minecraft:bat_spawn_egg",
+	"minecraft:bee_spawn_egg",
+	"minecraft:blaze_spawn_egg",
+	"minecraft:cat_spawn_egg",
+	"minecraft:cave_spider_spawn_egg",
+	"minecraft:chicken_spawn_egg",
+	"minecraft:cod_spawn_egg",
+	"minecraft:cow_spawn_egg",
+	"minecraft:creeper_spawn_egg",
+	"minecraft:dolphin_spawn_egg",
+	"minecraft:donkey_spawn_egg",
+	"minecraft:drowned_spawn_egg",
+	"minecraft:elder_guardian_spawn_egg",
+	"minecraft:enderman_spawn_egg",
+	"minecraft:endermite_spawn_egg",
+	"minecraft:evoker_spawn_egg",
+	"minecraft:fox_spawn_egg",
+	"minecraft:frog_spawn_egg",
+	"minecraft:ghast_spawn_egg",
+	"minecraft:glow_squid_spawn_egg",
+	"minecraft:goat_spawn_egg",
+	"minecraft:guardian_spawn_egg",
+	"minecraft:hoglin_spawn_egg",
+	"minecraft:horse_spawn_egg",
+	"minecraft:husk_spawn_egg",
+	"minecraft:llama_spawn_egg",
+	"minecraft:magma_cube_spawn_egg",
+	"minecraft:mooshroom_spawn_egg",
+	"minecraft:mule_spawn_egg",
+	"minecraft:ocelot_spawn_egg",
+	"minecraft:panda_spawn_egg",
+	"minecraft:parrot_spawn_egg",
+	"minecraft:phantom_spawn_egg",
+	"minecraft:pig_spawn_egg",
+	"minecraft:piglin_spawn_egg",
+	"minecraft:piglin_brute_spawn_egg",
+	"minecraft:pillager_spawn_egg",
+	"minecraft:polar_bear_spawn_egg",
+	"minecraft:pufferfish_spawn_egg",
+	"minecraft:rabbit_spawn_egg",
+	"minecraft:ravager_spawn_egg",
+	"minecraft:salmon_spawn_egg",
+	"minecraft:sheep_spawn_egg",
+	"minecraft:shulker_spawn_egg",
+	"minecraft:silverfish_spawn_egg",
+	"minecraft:skeleton_spawn_egg",
+	"minecraft:skeleton_horse_spawn_egg",
+	"minecraft:slime_spawn_egg",
+	"minecraft:spider_spawn_egg",
+	"minecraft:squid_spawn_egg",
+	"minecraft:stray_spawn_egg",
+	"minecraft:strider_spawn_egg",
+	"minecraft:tadpole_spawn_egg",
+	"minecraft:trader_llama_spawn_egg",
+	"minecraft:tropical_fish_spawn_egg",
+	"minecraft:turtle_spawn_egg",
+	"minecraft:vex_spawn_egg",
+	"minecraft:villager_spawn_egg",
+	"minecraft:vindicator_spawn_egg",
+	"minecraft:wandering_trader_spawn_egg",
+	"minecraft:warden_spawn_egg",
+	"minecraft:witch_spawn_egg",
+	"minecraft:wither_skeleton_spawn_egg",
+	"minecraft:wolf_spawn_egg",
+	"minecraft:zoglin_spawn_egg",
+	"minecraft:zombie_spawn_egg",
+	"minecraft:zombie_horse_spawn_egg",
+	"minecraft:zombie_villager_spawn_egg",
+	"minecraft:zombified_piglin_spawn_egg",
+}
+
+// IsItem reports whether the ID is a vanilla item, that is a block item or one of nonBlockItems.
+// A few blocks without an item form pass as well, that's fine for telling typos apart.
+func IsItem(id string) bool {
+	if IsBlock(id) {
+		return true
+	}
+
+	for _, currentID := range nonBlockItems {
+		if currentID == id {
+			return true
+		}
+	}
+
+	return false
+}
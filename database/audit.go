@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const AuditLogCollection = "audit_log"
+
+type StatChange struct {
+	Group StatGroupName `json:"group" bson:"group"`
+	Key   string        `json:"key" bson:"key"`
+	Old   float64       `json:"old" bson:"old"`
+	New   float64       `json:"new" bson:"new"`
+}
+
+// AuditEntry describes a single player update, Changes only keep the largest differences.
+type AuditEntry struct {
+	Timestamp      time.Time     `json:"timestamp" bson:"timestamp"`
+	KeyName        string        `json:"keyName" bson:"keyName"`
+	SourceIP       string        `json:"sourceIP" bson:"sourceIP"`
+	Server         string        `json:"server" bson:"server"`
+	UUID           string        `json:"uuid" bson:"uuid"`
+	Name           string        `json:"name" bson:"name"`
+	PreviousName   string        `json:"previousName,omitempty" bson:"previousName,omitempty"`
+	Created        bool          `json:"created" bson:"created"`
+	Status         int           `json:"status" bson:"status"`
+	Error          string        `json:"error,omitempty" bson:"error,omitempty"`
+	ChangedFields  int           `json:"changedFields" bson:"changedFields"`
+	DecreasedStats int           `json:"decreasedStats" bson:"decreasedStats"`
+	Changes        []*StatChange `json:"changes" bson:"changes"`
+}
+
+type AuditQuery struct {
+	UUID string
+	// Servers limit entries to these servers, nil for every server
+	Servers []string
+	KeyName string
+	From    time.Time
+	To      time.Time
+	Limit   int64
+}
+
+var auditLogIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "uuid", Value: 1}, {Key: "timestamp", Value: -1}}},
+	{Keys: bson.D{{Key: "timestamp", Value: -1}}},
+}
+
+func InsertAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	_, err := Database.Collection(AuditLogCollection).InsertOne(ctx, entry)
+	return err
+}
+
+// FindAuditEntries returns entries matching the query, newest first.
+func FindAuditEntries(ctx context.Context, query AuditQuery) ([]*AuditEntry, error) {
+	filter := bson.D{}
+	if query.UUID != "" {
+		filter = append(filter, bson.E{Key: "uuid", Value: query.UUID})
+	}
+
+	if query.Servers != nil {
+		filter = append(filter, bson.E{Key: "server", Value: bson.D{{Key: "$in", Value: query.Servers}}})
+	}
+
+	if query.KeyName != "" {
+		filter = append(filter, bson.E{Key: "keyName", Value: query.KeyName})
+	}
+
+	timeRange := bson.D{}
+	if !query.From.IsZero() {
+		timeRange = append(timeRange, bson.E{Key: "$gte", Value: query.From})
+	}
+
+	if !query.To.IsZero() {
+		timeRange = append(timeRange, bson.E{Key: "$lte", Value: query.To})
+	}
+
+	if len(timeRange) > 0 {
+		filter = append(filter, bson.E{Key: "timestamp", Value: timeRange})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(query.Limit)
+	cursor, err := Database.Collection(AuditLogCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*AuditEntry, 0)
+	err = cursor.All(ctx, &entries)
+	return entries, err
+}
@@ -2,8 +2,16 @@ package database
 
 import (
 	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -11,13 +19,91 @@ var (
 	Database *mongo.Database
 )
 
-func InitDatabase(uri string) (err error) {
-	clientOptions := options.Client().ApplyURI(uri)
+// CommandObserver is notified about every finished database command, failed is true if the command returned an error.
+var CommandObserver func(command string, duration time.Duration, failed bool)
+
+func observeCommand(command string, durationNanos int64, failed bool) {
+	if CommandObserver != nil {
+		CommandObserver(command, time.Duration(durationNanos), failed)
+	}
+}
+
+// tracingScopeName names the tracer of database commands, they are client spans of the span in the command context.
+const tracingScopeName = "github.com/bortexel/stats-server/database"
+
+type commandKey struct {
+	connectionID string
+	requestID    int64
+}
+
+// commandSpans holds spans of running commands, the driver reports finished commands with
+// their connection and request ID only, not with the context the command was started with.
+var (
+	commandSpansMu sync.Mutex
+	commandSpans   = make(map[commandKey]trace.Span)
+)
+
+func startCommandSpan(ctx context.Context, e *event.CommandStartedEvent) {
+	// The first element of a command is its name with the collection as the value
+	var collection string
+	if element, err := e.Command.IndexErr(0); err == nil {
+		collection, _ = element.Value().StringValueOK()
+	}
+
+	_, span := otel.Tracer(tracingScopeName).Start(ctx, "mongodb."+e.CommandName, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBNamespace(e.DatabaseName),
+			semconv.DBOperationName(e.CommandName),
+			semconv.DBCollectionName(collection),
+		))
+
+	// Unsampled spans record nothing, there is no point in keeping them around
+	if !span.IsRecording() {
+		return
+	}
+
+	commandSpansMu.Lock()
+	commandSpans[commandKey{connectionID: e.ConnectionID, requestID: e.RequestID}] = span
+	commandSpansMu.Unlock()
+}
+
+func finishCommandSpan(connectionID string, requestID int64, failure string) {
+	key := commandKey{connectionID: connectionID, requestID: requestID}
+	commandSpansMu.Lock()
+	span, ok := commandSpans[key]
+	delete(commandSpans, key)
+	commandSpansMu.Unlock()
+	if !ok {
+		return
+	}
+
+	if failure != "" {
+		span.SetStatus(codes.Error, failure)
+	}
+
+	span.End()
+}
+
+var commandMonitor = &event.CommandMonitor{
+	Started: startCommandSpan,
+	Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+		observeCommand(e.CommandName, e.DurationNanos, false)
+		finishCommandSpan(e.ConnectionID, e.RequestID, "")
+	},
+	Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+		observeCommand(e.CommandName, e.DurationNanos, true)
+		finishCommandSpan(e.ConnectionID, e.RequestID, e.Failure)
+	},
+}
+
+func InitDatabase(uri string, name string) (err error) {
+	clientOptions := options.Client().ApplyURI(uri).SetMonitor(commandMonitor)
 	Client, err = mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
 		return err
 	}
 
-	Database = Client.Database("stats")
+	Database = Client.Database(name)
 	return
 }
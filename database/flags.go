@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const AnomalyFlagsCollection = "anomaly_flags"
+
+type StatDelta struct {
+	Group StatGroupName `json:"group" bson:"group"`
+	Key   string        `json:"key" bson:"key"`
+	Delta float64       `json:"delta" bson:"delta"`
+	// Rate is the delta per hour of play time and Limit is the configured maximum of it
+	Rate  float64 `json:"rate" bson:"rate"`
+	Limit float64 `json:"limit" bson:"limit"`
+}
+
+// AnomalyFlag marks an update with suspiciously fast growing stats for moderation.
+type AnomalyFlag struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Timestamp     time.Time          `json:"timestamp" bson:"timestamp"`
+	Server        string             `json:"server" bson:"server"`
+	UUID          string             `json:"uuid" bson:"uuid"`
+	Name          string             `json:"name" bson:"name"`
+	KeyName       string             `json:"keyName" bson:"keyName"`
+	PlayTimeDelta float64            `json:"playTimeDelta" bson:"playTimeDelta"`
+	Deltas        []*StatDelta       `json:"deltas" bson:"deltas"`
+	Reviewed      bool               `json:"reviewed" bson:"reviewed"`
+}
+
+type AnomalyFlagQuery struct {
+	// Servers limit flags to these servers, nil for every server
+	Servers         []string
+	UUID            string
+	IncludeReviewed bool
+	Limit           int64
+}
+
+func InsertAnomalyFlag(ctx context.Context, flag *AnomalyFlag) error {
+	_, err := Database.Collection(AnomalyFlagsCollection).InsertOne(ctx, flag)
+	return err
+}
+
+// FindAnomalyFlags returns flags matching the query, newest first.
+func FindAnomalyFlags(ctx context.Context, query AnomalyFlagQuery) ([]*AnomalyFlag, error) {
+	filter := bson.D{}
+	if query.Servers != nil {
+		filter = append(filter, bson.E{Key: "server", Value: bson.D{{Key: "$in", Value: query.Servers}}})
+	}
+
+	if query.UUID != "" {
+		filter = append(filter, bson.E{Key: "uuid", Value: query.UUID})
+	}
+
+	if !query.IncludeReviewed {
+		filter = append(filter, bson.E{Key: "reviewed", Value: false})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(query.Limit)
+	cursor, err := Database.Collection(AnomalyFlagsCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make([]*AnomalyFlag, 0)
+	err = cursor.All(ctx, &flags)
+	return flags, err
+}
+
+// FindAnomalyFlag returns the flag with the given id or nil if there is no such flag.
+func FindAnomalyFlag(ctx context.Context, id primitive.ObjectID) (*AnomalyFlag, error) {
+	var flag AnomalyFlag
+	err := Database.Collection(AnomalyFlagsCollection).FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&flag)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &flag, nil
+}
+
+// MarkAnomalyFlagReviewed reports false if there is no flag with the id.
+func MarkAnomalyFlagReviewed(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	result, err := Database.Collection(AnomalyFlagsCollection).UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: id}}, bson.D{{Key: "$set", Value: bson.D{{Key: "reviewed", Value: true}}}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+var anomalyFlagIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "reviewed", Value: 1}, {Key: "timestamp", Value: -1}}},
+	{Keys: bson.D{{Key: "uuid", Value: 1}, {Key: "timestamp", Value: -1}}},
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// requiredIndexes are the indexes of service collections by collection name.
+var requiredIndexes = map[string][]mongo.IndexModel{
+	APIKeysCollection:      apiKeyIndexes,
+	AuditLogCollection:     auditLogIndexes,
+	AnomalyFlagsCollection: anomalyFlagIndexes,
+}
+
+// EnsureIndexes creates missing indexes of service collections.
+func EnsureIndexes(ctx context.Context) error {
+	for collection, indexes := range requiredIndexes {
+		_, err := Database.Collection(collection).Indexes().CreateMany(ctx, indexes)
+		if err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+	}
+
+	return nil
+}
+
+// IndexName returns the name MongoDB gives an index by default, like "uuid_1_timestamp_-1".
+func IndexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// ListIndexNames returns names of existing indexes of a collection.
+func ListIndexNames(ctx context.Context, collection string) (map[string]bool, error) {
+	cursor, err := Database.Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []struct {
+		Name string `bson:"name"`
+	}
+
+	err = cursor.All(ctx, &indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(indexes))
+	for _, index := range indexes {
+		names[index.Name] = true
+	}
+
+	return names, nil
+}
+
+// MissingIndexes returns names of required indexes that don't exist, by collection.
+func MissingIndexes(ctx context.Context) (map[string][]string, error) {
+	missing := make(map[string][]string)
+	for collection, indexes := range requiredIndexes {
+		existing, err := ListIndexNames(ctx, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, index := range indexes {
+			if name := IndexName(index.Keys.(bson.D)); !existing[name] {
+				missing[collection] = append(missing[collection], name)
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// playerIndexes are created on every season collection, updates look players up by uuid
+// and leaderboards may filter by name.
+var playerIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "uuid", Value: 1}}, Options: options.Index().SetUnique(true)},
+	{Keys: bson.D{{Key: "name", Value: 1}}},
+}
+
+// StatIndexKeys returns the keys of the index on a stat path. They match the default leaderboard
+// sort, descending by the stat with the UUID as tie-breaker, so pages are read from the index.
+// Ascending leaderboards sort by {path: 1, uuid: 1}, which isn't this index walked backwards,
+// so they are still sorted in memory.
+func StatIndexKeys(path string) bson.D {
+	return bson.D{{Key: path, Value: -1}, {Key: "uuid", Value: 1}}
+}
+
+// EnsurePlayerIndexes creates the player indexes and the indexes of stat paths on a season
+// collection, creating the collection if it doesn't exist yet.
+func EnsurePlayerIndexes(ctx context.Context, collection string, statPaths []string) error {
+	indexes := append([]mongo.IndexModel{}, playerIndexes...)
+	for _, path := range statPaths {
+		indexes = append(indexes, mongo.IndexModel{Keys: StatIndexKeys(path)})
+	}
+
+	_, err := Database.Collection(collection).Indexes().CreateMany(ctx, indexes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", collection, err)
+	}
+
+	return nil
+}
+
+// CollectionExists reports whether a collection has been created, by inserts or by indexes.
+func CollectionExists(ctx context.Context, collection string) (bool, error) {
+	names, err := Database.ListCollectionNames(ctx, bson.D{{Key: "name", Value: collection}})
+	if err != nil {
+		return false, err
+	}
+
+	return len(names) > 0, nil
+}
+
+// ListStatIndexes returns stat paths of a season collection that have an index.
+func ListStatIndexes(ctx context.Context, collection string) ([]string, error) {
+	cursor, err := Database.Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []struct {
+		Keys bson.D `bson:"key"`
+	}
+
+	err = cursor.All(ctx, &indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0)
+	for _, index := range indexes {
+		if len(index.Keys) > 0 && strings.HasPrefix(index.Keys[0].Key, "stats.") {
+			paths = append(paths, index.Keys[0].Key)
+		}
+	}
+
+	return paths, nil
+}
+
+// DropStatIndex drops the index of a stat path, it reports false if there was no such index.
+// Single field indexes created before the UUID tie-breaker was added are dropped as well.
+func DropStatIndex(ctx context.Context, collection string, path string) (bool, error) {
+	existing, err := ListIndexNames(ctx, collection)
+	if err != nil {
+		return false, err
+	}
+
+	dropped := false
+	for _, name := range []string{IndexName(StatIndexKeys(path)), IndexName(bson.D{{Key: path, Value: -1}})} {
+		if !existing[name] {
+			continue
+		}
+
+		_, err = Database.Collection(collection).Indexes().DropOne(ctx, name)
+		if err != nil {
+			return dropped, err
+		}
+
+		dropped = true
+	}
+
+	return dropped, nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const APIKeysCollection = "api_keys"
+
+// APIKey is an access key of a game server or a staff member. Only the hash of the secret
+// is stored, the secret itself is shown once when the key is created. Keys that sign requests
+// also have the hex-encoded Ed25519 public key, the private key never reaches the server.
+type APIKey struct {
+	Name      string    `json:"name" bson:"name"`
+	Hash      string    `json:"-" bson:"hash"`
+	PublicKey string    `json:"publicKey,omitempty" bson:"publicKey,omitempty"`
+	Servers   []string  `json:"servers" bson:"servers"`
+	Scopes    []string  `json:"scopes" bson:"scopes"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, current := range k.Scopes {
+		if current == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsServer reports whether the key may be used for a season collection, "*" allows every server.
+func (k *APIKey) AllowsServer(server string) bool {
+	for _, current := range k.Servers {
+		if current == "*" || current == server {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ServerScope returns the servers the key is limited to, nil if it allows every server.
+func (k *APIKey) ServerScope() []string {
+	if k.AllowsServer("*") {
+		return nil
+	}
+
+	// Never nil, a key without servers matches none of them
+	return append([]string{}, k.Servers...)
+}
+
+var apiKeyIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+}
+
+// FindAPIKey returns the key with the given hash or nil if there is no such key.
+func FindAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	var key APIKey
+	err := Database.Collection(APIKeysCollection).FindOne(ctx, bson.D{{Key: "hash", Value: hash}}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// FindAPIKeyByName returns the key with the given name or nil if there is no such key.
+func FindAPIKeyByName(ctx context.Context, name string) (*APIKey, error) {
+	var key APIKey
+	err := Database.Collection(APIKeysCollection).FindOne(ctx, bson.D{{Key: "name", Value: name}}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func InsertAPIKey(ctx context.Context, key *APIKey) error {
+	_, err := Database.Collection(APIKeysCollection).InsertOne(ctx, key)
+	return err
+}
+
+func ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := Database.Collection(APIKeysCollection).Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*APIKey, 0)
+	err = cursor.All(ctx, &keys)
+	return keys, err
+}
+
+// DeleteAPIKey removes a key by its name and reports whether it existed.
+func DeleteAPIKey(ctx context.Context, name string) (bool, error) {
+	result, err := Database.Collection(APIKeysCollection).DeleteOne(ctx, bson.D{{Key: "name", Value: name}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.DeletedCount > 0, nil
+}
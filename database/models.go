@@ -1,5 +1,7 @@
 package database
 
+import "time"
+
 type Advancement struct {
 	Key   string `json:"key" bson:"key"`
 	Tab   string `json:"tab" bson:"-"`
@@ -19,6 +21,7 @@ type StoredPlayer struct {
 	Name         string         `json:"name" bson:"name"`
 	Stats        StatsContainer `json:"stats,omitempty" bson:"stats"`
 	Advancements []*Advancement `json:"advancements,omitempty" bson:"advancements"`
+	UpdatedAt    time.Time      `json:"-" bson:"updatedAt,omitempty"`
 }
 
 type Player struct {
@@ -26,6 +29,7 @@ type Player struct {
 	Name         string         `json:"name" bson:"name"`
 	Stats        StatsContainer `json:"stats" bson:"stats"`
 	Advancements []*Advancement `json:"advancements" bson:"advancements"`
+	UpdatedAt    time.Time      `json:"-" bson:"updatedAt"`
 }
 
 type Stat struct {
@@ -43,7 +47,8 @@ func (m StatsMap) GetValueSum(keyFilter func(key string) bool) int64 {
 			continue
 		}
 
-		result += int64(value.(float64))
+		number, _ := NumericValue(value)
+		result += int64(number)
 	}
 	return result
 }
@@ -52,6 +57,44 @@ func EmptyPredicate(_ string) bool {
 	return true
 }
 
+// NumericValue converts a stat value to float64. Values decoded from JSON are always float64,
+// but the ones read back from MongoDB may be stored as any of the BSON number types.
+func NumericValue(value any) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	default:
+		return 0, false
+	}
+}
+
+// Add sums every numeric value of other into the container, creating missing groups.
+func (c StatsContainer) Add(other StatsContainer) {
+	for groupName, stats := range other {
+		if _, ok := c[groupName]; !ok {
+			c[groupName] = make(StatsMap)
+		}
+
+		for key, value := range stats {
+			number, ok := NumericValue(value)
+			if !ok {
+				continue
+			}
+
+			current, _ := NumericValue(c[groupName][key])
+			c[groupName][key] = current + number
+		}
+	}
+}
+
 type StatGroupName string
 
 const (
@@ -92,3 +135,13 @@ func MakeStatsContainer() StatsContainer {
 
 	return container
 }
+
+func IsKnownStatGroup(groupName StatGroupName) bool {
+	for _, currentGroupName := range defaultStatGroups {
+		if currentGroupName == groupName {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const PendingUpdatesCollection = "pending_updates"
+
+// PendingUpdate is an update held back for review because it would have decreased stats.
+type PendingUpdate struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ReceivedAt       time.Time          `json:"receivedAt" bson:"receivedAt"`
+	Server           string             `json:"server" bson:"server"`
+	UUID             string             `json:"uuid" bson:"uuid"`
+	Name             string             `json:"name" bson:"name"`
+	KeyName          string             `json:"keyName" bson:"keyName"`
+	SourceIP         string             `json:"sourceIP" bson:"sourceIP"`
+	DecreasedStats   int                `json:"decreasedStats" bson:"decreasedStats"`
+	DecreasedValue   float64            `json:"decreasedValue" bson:"decreasedValue"`
+	PlayTimeDecrease float64            `json:"playTimeDecrease" bson:"playTimeDecrease"`
+	Body             string             `json:"body" bson:"body"`
+	// PlayerUpdatedAt is when the stored player was last updated before this update was held back
+	PlayerUpdatedAt time.Time `json:"playerUpdatedAt" bson:"playerUpdatedAt"`
+}
+
+func InsertPendingUpdate(ctx context.Context, update *PendingUpdate) (primitive.ObjectID, error) {
+	result, err := Database.Collection(PendingUpdatesCollection).InsertOne(ctx, update)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	id, _ := result.InsertedID.(primitive.ObjectID)
+	return id, nil
+}
+
+// FindPendingUpdates lists pending updates, oldest first, optionally only of some servers.
+func FindPendingUpdates(ctx context.Context, servers []string, limit int64) ([]*PendingUpdate, error) {
+	filter := bson.D{}
+	if servers != nil {
+		filter = append(filter, bson.E{Key: "server", Value: bson.D{{Key: "$in", Value: servers}}})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "receivedAt", Value: 1}}).SetLimit(limit)
+	cursor, err := Database.Collection(PendingUpdatesCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]*PendingUpdate, 0)
+	err = cursor.All(ctx, &updates)
+	return updates, err
+}
+
+// FindPendingUpdate returns the pending update with the given id or nil if there is no such update.
+func FindPendingUpdate(ctx context.Context, id primitive.ObjectID) (*PendingUpdate, error) {
+	var update PendingUpdate
+	err := Database.Collection(PendingUpdatesCollection).FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&update)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &update, nil
+}
+
+func DeletePendingUpdate(ctx context.Context, id primitive.ObjectID) error {
+	_, err := Database.Collection(PendingUpdatesCollection).DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	return err
+}
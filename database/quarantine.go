@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const QuarantinedStatsCollection = "quarantined_stats"
+
+type InvalidStat struct {
+	Group  StatGroupName `json:"group" bson:"group"`
+	Key    string        `json:"key" bson:"key"`
+	Value  any           `json:"value" bson:"value"`
+	Reason string        `json:"reason" bson:"reason"`
+}
+
+// QuarantinedStats keeps stats that were removed from an update, so they can be recovered
+// if a registry turns out to be outdated.
+type QuarantinedStats struct {
+	Timestamp time.Time      `json:"timestamp" bson:"timestamp"`
+	Server    string         `json:"server" bson:"server"`
+	UUID      string         `json:"uuid" bson:"uuid"`
+	Stats     []*InvalidStat `json:"stats" bson:"stats"`
+}
+
+func InsertQuarantinedStats(ctx context.Context, quarantined *QuarantinedStats) error {
+	_, err := Database.Collection(QuarantinedStatsCollection).InsertOne(ctx, quarantined)
+	return err
+}
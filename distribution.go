@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/bortexel/stats-server/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultDistributionBuckets = 10
+	MaxDistributionBuckets     = 100
+)
+
+type DistributionRequest struct {
+	Server     ServerIdentifier `json:"server"`
+	Field      StatField        `json:"field"`
+	PlayerUUID string           `json:"playerUUID"`
+	Buckets    int              `json:"buckets"`
+	LogScale   bool             `json:"logScale"`
+}
+
+type DistributionBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+type PlayerPercentile struct {
+	UUID  string  `json:"uuid"`
+	Value float64 `json:"value"`
+	// Rank is 1 for the player with the highest value, players with equal values share the rank
+	Rank int `json:"rank"`
+	// Percentile is the share of players with a lower value
+	Percentile float64 `json:"percentile"`
+	// TopPercent is the share of players with the same or higher value, as in "top 5%"
+	TopPercent float64 `json:"topPercent"`
+}
+
+type DistributionResponse struct {
+	Server  ServerIdentifier      `json:"server"`
+	Field   StatField             `json:"field"`
+	Players int                   `json:"players"`
+	Min     float64               `json:"min"`
+	Max     float64               `json:"max"`
+	Mean    float64               `json:"mean"`
+	Median  float64               `json:"median"`
+	Buckets []*DistributionBucket `json:"buckets"`
+	Player  *PlayerPercentile     `json:"player,omitempty"`
+}
+
+func (r *DistributionRequest) validate() error {
+	if r.Server.ServerName == "" {
+		return errors.New("server is required")
+	}
+
+	if r.Field.GroupName == "" || r.Field.FieldName == "" {
+		return errors.New("field is required")
+	}
+
+	if r.Buckets == 0 {
+		r.Buckets = DefaultDistributionBuckets
+	}
+
+	if r.Buckets < 1 || r.Buckets > MaxDistributionBuckets {
+		return errors.New("invalid bucket count")
+	}
+
+	return nil
+}
+
+// fieldValueExpression is the value of a field in a pipeline, players that don't have the stat yet count as zero.
+func fieldValueExpression(field StatField) bson.M {
+	path := "$" + field.GetFullPath()
+	return bson.M{"$cond": bson.A{bson.M{"$isNumber": path}, path, 0}}
+}
+
+type distributionSummary struct {
+	Players int     `bson:"players"`
+	Min     float64 `bson:"min"`
+	Max     float64 `bson:"max"`
+	Sum     float64 `bson:"sum"`
+}
+
+type distributionCount struct {
+	Count int `bson:"count"`
+}
+
+type distributionShape struct {
+	Buckets []struct {
+		Index int `bson:"_id"`
+		Count int `bson:"count"`
+	} `bson:"buckets"`
+	Median []struct {
+		Value float64 `bson:"value"`
+	} `bson:"median"`
+	Lower  []distributionCount `bson:"lower"`
+	Higher []distributionCount `bson:"higher"`
+}
+
+// fetchDistributionSummary counts players of a season and finds the range of a field. Values stay
+// in the database, computing the distribution must not load every player of a season into memory.
+func fetchDistributionSummary(ctx context.Context, server ServerIdentifier, field StatField) (*distributionSummary, error) {
+	cursor, err := database.Database.Collection(server.String()).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.D{{Key: "value", Value: fieldValueExpression(field)}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "players", Value: bson.M{"$sum": 1}},
+			{Key: "min", Value: bson.M{"$min": "$value"}},
+			{Key: "max", Value: bson.M{"$max": "$value"}},
+			{Key: "sum", Value: bson.M{"$sum": "$value"}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*distributionSummary
+	err = cursor.All(ctx, &results)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+
+	return results[0], nil
+}
+
+// fetchDistributionShape counts players in each bucket, finds the median values and, for a player
+// value, counts players below and above it, all in a single pass over the season.
+func fetchDistributionShape(ctx context.Context, server ServerIdentifier, field StatField, scale bucketScale,
+	players int, playerValue *float64) (*distributionShape, error) {
+	facets := bson.D{
+		{Key: "buckets", Value: bson.A{
+			bson.M{"$group": bson.M{"_id": scale.indexExpression("$value"), "count": bson.M{"$sum": 1}}},
+		}},
+		{Key: "median", Value: bson.A{
+			bson.M{"$sort": bson.M{"value": 1}},
+			bson.M{"$skip": (players - 1) / 2},
+			bson.M{"$limit": 2 - players%2},
+		}},
+	}
+
+	if playerValue != nil {
+		facets = append(facets,
+			bson.E{Key: "lower", Value: bson.A{
+				bson.M{"$match": bson.M{"value": bson.M{"$lt": *playerValue}}},
+				bson.M{"$count": "count"},
+			}},
+			bson.E{Key: "higher", Value: bson.A{
+				bson.M{"$match": bson.M{"value": bson.M{"$gt": *playerValue}}},
+				bson.M{"$count": "count"},
+			}},
+		)
+	}
+
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cursor, err := database.Database.Collection(server.String()).Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$project", Value: bson.D{{Key: "value", Value: fieldValueExpression(field)}}}},
+		{{Key: "$facet", Value: facets}},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*distributionShape
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return &distributionShape{}, nil
+	}
+
+	return results[0], nil
+}
+
+// bucketScale splits the range of values into equal buckets. On a log scale the edges
+// are spread evenly over log(1+x), so zero values still fit into the first bucket.
+type bucketScale struct {
+	logScale bool
+	from     float64
+	width    float64
+	count    int
+}
+
+func newBucketScale(low, high float64, count int, logScale bool) bucketScale {
+	scale := bucketScale{logScale: logScale && low >= 0, count: count}
+	scale.from = scale.scale(low)
+	scale.width = (scale.scale(high) - scale.from) / float64(count)
+	return scale
+}
+
+func (s bucketScale) scale(x float64) float64 {
+	if s.logScale {
+		return math.Log1p(x)
+	}
+
+	return x
+}
+
+func (s bucketScale) unscale(x float64) float64 {
+	if s.logScale {
+		return math.Expm1(x)
+	}
+
+	return x
+}
+
+// indexExpression computes the bucket index of a value in a pipeline, the highest value belongs to the last bucket.
+// The index is clamped at both ends, $ln in MongoDB may round the lowest value 1 ulp below math.Log1p.
+func (s bucketScale) indexExpression(value string) any {
+	if s.width <= 0 {
+		return s.count - 1
+	}
+
+	scaled := any(value)
+	if s.logScale {
+		scaled = bson.M{"$ln": bson.A{bson.M{"$add": bson.A{1, value}}}}
+	}
+
+	index := bson.M{"$floor": bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{scaled, s.from}}, s.width}}}
+	return bson.M{"$max": bson.A{0, bson.M{"$min": bson.A{s.count - 1, index}}}}
+}
+
+func (s bucketScale) makeBuckets(high float64) []*DistributionBucket {
+	buckets := make([]*DistributionBucket, s.count)
+	for i := range buckets {
+		buckets[i] = &DistributionBucket{
+			From: s.unscale(s.from + s.width*float64(i)),
+			To:   s.unscale(s.from + s.width*float64(i+1)),
+		}
+	}
+
+	buckets[s.count-1].To = high
+	return buckets
+}
+
+func makePlayerPercentile(uuid string, value float64, lower, higher, total int) *PlayerPercentile {
+	return &PlayerPercentile{
+		UUID:       uuid,
+		Value:      value,
+		Rank:       higher + 1,
+		Percentile: float64(lower) / float64(total) * 100,
+		TopPercent: float64(total-lower) / float64(total) * 100,
+	}
+}
+
+// fetchPlayerValue returns the value of a field for a player, nil if the player isn't in the season.
+func fetchPlayerValue(ctx context.Context, server ServerIdentifier, field StatField, uuid string) (*float64, error) {
+	opts := options.FindOne().SetProjection(bson.D{{Key: field.GetFullPath(), Value: 1}})
+
+	var player database.StoredPlayer
+	err := database.Database.Collection(server.String()).
+		FindOne(ctx, bson.D{{Key: "uuid", Value: uuid}}, opts).Decode(&player)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := database.NumericValue(player.Stats[database.StatGroupName(field.GroupName)][field.FieldName])
+	return &value, nil
+}
+
+func HandleDistribution(r *http.Request, body []byte) (any, error, int) {
+	var request DistributionRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	err = request.validate()
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationAggregate)
+	defer cancel()
+
+	summary, err := fetchDistributionSummary(ctx, request.Server, request.Field)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if summary == nil || summary.Players == 0 {
+		return nil, nil, http.StatusNotFound
+	}
+
+	var playerValue *float64
+	if request.PlayerUUID != "" {
+		playerValue, err = fetchPlayerValue(ctx, request.Server, request.Field, request.PlayerUUID)
+		if err != nil {
+			return databaseError(err)
+		}
+
+		if playerValue == nil {
+			return nil, nil, http.StatusNotFound
+		}
+	}
+
+	scale := newBucketScale(summary.Min, summary.Max, request.Buckets, request.LogScale)
+	shape, err := fetchDistributionShape(ctx, request.Server, request.Field, scale, summary.Players, playerValue)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	response := &DistributionResponse{
+		Server:  request.Server,
+		Field:   request.Field,
+		Players: summary.Players,
+		Min:     summary.Min,
+		Max:     summary.Max,
+		Mean:    summary.Sum / float64(summary.Players),
+		Buckets: scale.makeBuckets(summary.Max),
+	}
+
+	for _, bucket := range shape.Buckets {
+		if bucket.Index >= 0 && bucket.Index < len(response.Buckets) {
+			response.Buckets[bucket.Index].Count += bucket.Count
+		}
+	}
+
+	for _, median := range shape.Median {
+		response.Median += median.Value / float64(len(shape.Median))
+	}
+
+	if playerValue != nil {
+		var lower, higher int
+		if len(shape.Lower) > 0 {
+			lower = shape.Lower[0].Count
+		}
+
+		if len(shape.Higher) > 0 {
+			higher = shape.Higher[0].Count
+		}
+
+		response.Player = makePlayerPercentile(request.PlayerUUID, *playerValue, lower, higher, summary.Players)
+	}
+
+	return response, nil, http.StatusOK
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envReader reads overrides from environment variables. Values that don't parse keep the fallback
+// and are collected as problems, so a typo is reported instead of quietly ignored.
+type envReader struct {
+	problems []string
+}
+
+// lookup returns a variable unless it is unset or empty, empty variables don't override numbers or flags.
+func (e *envReader) lookup(name string) (string, bool) {
+	value := os.Getenv(name)
+	return value, value != ""
+}
+
+func (e *envReader) invalid(name string, value string, kind string) {
+	e.problems = append(e.problems, fmt.Sprintf("%s: %q is not a valid %s", name, value, kind))
+}
+
+func (e *envReader) Int(name string, fallback int) int {
+	value, ok := e.lookup(name)
+	if !ok {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		e.invalid(name, value, "integer")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (e *envReader) Float(name string, fallback float64) float64 {
+	value, ok := e.lookup(name)
+	if !ok {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		e.invalid(name, value, "number")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (e *envReader) Duration(name string, fallback time.Duration) time.Duration {
+	value, ok := e.lookup(name)
+	if !ok {
+		return fallback
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		e.invalid(name, value, "duration, like 30s")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (e *envReader) Bool(name string, fallback bool) bool {
+	value, ok := e.lookup(name)
+	if !ok {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		e.invalid(name, value, "boolean, like true or false")
+		return fallback
+	}
+
+	return parsed
+}
+
+func (e *envReader) String(name string, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+
+	return fallback
+}
+
+// List reads a comma-separated list, an empty variable overrides the fallback with an empty list.
+func (e *envReader) List(name string, fallback []string) []string {
+	if value, ok := os.LookupEnv(name); ok {
+		return splitList(value)
+	}
+
+	return fallback
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	MaxFilterUUIDs        = 100
+	MaxFilterStatRanges   = 10
+	MaxFilterAdvancements = 10
+	MaxNameQueryLength    = 16
+)
+
+// LeaderboardWhere holds additional conditions of a leaderboard query. Every operator is
+// chosen by the server and clients only provide typed values, so no raw Mongo operators
+// can get into the filter.
+type LeaderboardWhere struct {
+	PlayerUUIDs     []string    `json:"playerUUIDs"`
+	NamePrefix      string      `json:"namePrefix"`
+	NameContains    string      `json:"nameContains"`
+	StatRanges      []StatRange `json:"stats"`
+	HasAdvancements []string    `json:"hasAdvancements"`
+}
+
+// StatRange matches players whose stat is within inclusive bounds, any of them may be omitted.
+type StatRange struct {
+	Field StatField `json:"field"`
+	Min   *float64  `json:"min"`
+	Max   *float64  `json:"max"`
+}
+
+func (r StatRange) makeCondition() (bson.D, error) {
+	if r.Field.GroupName == "" || r.Field.FieldName == "" {
+		return nil, errors.New("stat range field group and name are required")
+	}
+
+	if r.Min == nil && r.Max == nil {
+		return nil, errors.New("stat range requires min or max")
+	}
+
+	bounds := bson.D{}
+	if r.Min != nil {
+		bounds = append(bounds, bson.E{Key: "$gte", Value: *r.Min})
+	}
+
+	if r.Max != nil {
+		bounds = append(bounds, bson.E{Key: "$lte", Value: *r.Max})
+	}
+
+	return bson.D{{Key: r.Field.GetFullPath(), Value: bounds}}, nil
+}
+
+// makeNameCondition matches names containing the query, or starting with it. The limit applies to the
+// query as sent by the client, so the longest Minecraft name still fits after it is turned into a pattern.
+func makeNameCondition(query string, prefix bool) (bson.D, error) {
+	if len(query) > MaxNameQueryLength {
+		return nil, errors.New("name query is too long")
+	}
+
+	pattern := regexp.QuoteMeta(query)
+	if prefix {
+		pattern = "^" + pattern
+	}
+
+	return bson.D{{Key: "name", Value: bson.D{
+		{Key: "$regex", Value: pattern},
+		{Key: "$options", Value: "i"},
+	}}}, nil
+}
+
+func (w LeaderboardWhere) makeConditions() ([]bson.D, error) {
+	conditions := make([]bson.D, 0)
+
+	if len(w.PlayerUUIDs) > MaxFilterUUIDs {
+		return nil, errors.New("too many player UUIDs")
+	}
+
+	if len(w.PlayerUUIDs) > 0 {
+		conditions = append(conditions, bson.D{{Key: "uuid", Value: bson.D{{Key: "$in", Value: w.PlayerUUIDs}}}})
+	}
+
+	if w.NamePrefix != "" {
+		condition, err := makeNameCondition(w.NamePrefix, true)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if w.NameContains != "" {
+		condition, err := makeNameCondition(w.NameContains, false)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if len(w.StatRanges) > MaxFilterStatRanges {
+		return nil, errors.New("too many stat ranges")
+	}
+
+	for _, statRange := range w.StatRanges {
+		condition, err := statRange.makeCondition()
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if len(w.HasAdvancements) > MaxFilterAdvancements {
+		return nil, errors.New("too many advancements")
+	}
+
+	if len(w.HasAdvancements) > 0 {
+		conditions = append(conditions, bson.D{{Key: "advancements.key", Value: bson.D{{Key: "$all", Value: w.HasAdvancements}}}})
+	}
+
+	return conditions, nil
+}
+
+// combineConditions joins conditions with $and, so several of them may target the same field.
+func combineConditions(conditions []bson.D) bson.D {
+	switch len(conditions) {
+	case 0:
+		return bson.D{}
+	case 1:
+		return conditions[0]
+	default:
+		return bson.D{{Key: "$and", Value: conditions}}
+	}
+}
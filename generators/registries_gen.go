@@ -0,0 +1,127 @@
+//go:build generate
+// +build generate
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/template"
+)
+
+const (
+	MinecraftVersion = "1.19"
+	DataURL          = "https://raw.githubusercontent.com/PrismarineJS/minecraft-data/master/data/pc/" + MinecraftVersion + "/"
+)
+
+const RegistryTemplate = `
+// This file was generated by registries_gen.go. Any changes will be lost.
+
+package data
+
+var {{ .Variable }} = []string{
+	{{ range .IDs }}"{{ . }}",
+	{{ end }}
+}
+
+func {{ .Function }}(id string) bool {
+	for _, currentID := range {{ .Variable }} {
+		if currentID == id {
+			return true
+		}
+	}
+
+	return false
+}
+`
+
+// Registry is a list of minecraft-data written to a Go file of the data package.
+type Registry struct {
+	Source   string
+	File     string
+	Variable string
+	Function string
+	IDs      []string
+}
+
+var registries = []*Registry{
+	{Source: "blocks.json", File: "blocks.go", Variable: "blocks", Function: "IsBlock"},
+	{Source: "items.json", File: "items.go", Variable: "items", Function: "IsItem"},
+	{Source: "entities.json", File: "entities.go", Variable: "entities", Function: "IsEntity"},
+}
+
+func FetchIDs(source string) ([]string, error) {
+	response, err := http.Get(DataURL + source)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", source, response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []map[string]any
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0)
+	for _, entry := range data {
+		result = append(result, fmt.Sprintf("minecraft:%s", entry["name"]))
+	}
+
+	return result, nil
+}
+
+func (r *Registry) Generate(tpl *template.Template) error {
+	var err error
+	r.IDs, err = FetchIDs(r.Source)
+	if err != nil {
+		return fmt.Errorf("unable to fetch %s: %w", r.Source, err)
+	}
+
+	file, err := os.Create("../data/" + r.File)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", r.File, err)
+	}
+
+	defer file.Close()
+	return tpl.Execute(file, r)
+}
+
+//go:generate go run $GOFILE
+//go:generate go fmt ../data/blocks.go ../data/items.go ../data/entities.go
+func main() {
+	err := os.MkdirAll("../data", 0755)
+	if err != nil {
+		fmt.Println("Unable to make dirs:", err)
+		os.Exit(1)
+		return
+	}
+
+	tpl, err := template.New("").Parse(RegistryTemplate)
+	if err != nil {
+		fmt.Println("Unable to parse registry template:", err)
+		os.Exit(1)
+		return
+	}
+
+	for _, registry := range registries {
+		err = registry.Generate(tpl)
+		if err != nil {
+			fmt.Println("Error generating registries:", err)
+			os.Exit(1)
+			return
+		}
+	}
+}
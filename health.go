@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+const readinessTimeout = 3 * time.Second
+
+const (
+	HealthStatusOK    = "ok"
+	HealthStatusError = "error"
+)
+
+type DependencyStatus struct {
+	Status    string              `json:"status"`
+	LatencyMS int64               `json:"latencyMs,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Missing   map[string][]string `json:"missing,omitempty"`
+}
+
+type HealthReport struct {
+	Status       string                       `json:"status"`
+	Dependencies map[string]*DependencyStatus `json:"dependencies,omitempty"`
+}
+
+// HandleLiveness only reports that the process serves requests, it never touches dependencies,
+// so a database outage doesn't get the instance restarted.
+func HandleLiveness(_ *http.Request, _ []byte) (any, error, int) {
+	return &HealthReport{Status: HealthStatusOK}, nil, http.StatusOK
+}
+
+func checkDatabase(ctx context.Context) *DependencyStatus {
+	startedAt := time.Now()
+	err := database.Client.Ping(ctx, readpref.Primary())
+	status := &DependencyStatus{Status: HealthStatusOK, LatencyMS: time.Since(startedAt).Milliseconds()}
+	if err != nil {
+		status.Status, status.Error = HealthStatusError, err.Error()
+	}
+
+	return status
+}
+
+func checkIndexes(ctx context.Context) *DependencyStatus {
+	missing, err := database.MissingIndexes(ctx)
+	if err != nil {
+		return &DependencyStatus{Status: HealthStatusError, Error: err.Error()}
+	}
+
+	if len(missing) > 0 {
+		return &DependencyStatus{Status: HealthStatusError, Missing: missing}
+	}
+
+	return &DependencyStatus{Status: HealthStatusOK}
+}
+
+// HandleReadiness checks dependencies and answers 503 if any of them is broken, so traffic
+// is routed to other instances.
+func HandleReadiness(_ *http.Request, _ []byte) (any, error, int) {
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+
+	report := &HealthReport{
+		Status:       HealthStatusOK,
+		Dependencies: map[string]*DependencyStatus{"mongodb": checkDatabase(ctx)},
+	}
+
+	// Index checks would only repeat the connection error
+	if report.Dependencies["mongodb"].Status == HealthStatusOK {
+		report.Dependencies["indexes"] = checkIndexes(ctx)
+	}
+
+	for _, dependency := range report.Dependencies {
+		if dependency.Status != HealthStatusOK {
+			report.Status = HealthStatusError
+			return report, nil, http.StatusServiceUnavailable
+		}
+	}
+
+	return report, nil, http.StatusOK
+}
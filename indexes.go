@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+// StatIndexConfig lists stat fields, like "minecraft:custom/minecraft:play_time", that are indexed
+// for leaderboards. Server is a season collection like survival_5, a server name like survival
+// for each of its seasons, or "*" for every season.
+type StatIndexConfig struct {
+	Server string   `yaml:"server"`
+	Fields []string `yaml:"fields"`
+}
+
+func (c StatIndexConfig) matches(season ServerIdentifier) bool {
+	return c.Server == "*" || c.Server == season.ServerName || c.Server == season.String()
+}
+
+func parseStatIndexField(value string) (StatField, error) {
+	group, key, found := strings.Cut(value, "/")
+	if !found || group == "" || key == "" {
+		return StatField{}, fmt.Errorf("invalid stat field %q, expected group/key", value)
+	}
+
+	if !database.IsKnownStatGroup(database.StatGroupName(group)) {
+		return StatField{}, fmt.Errorf("unknown stat group %q", group)
+	}
+
+	return StatField{GroupName: group, FieldName: key}, nil
+}
+
+func validateStatIndexes(indexes []StatIndexConfig) []string {
+	problems := make([]string, 0)
+	for i, index := range indexes {
+		path := fmt.Sprintf("indexes[%d]", i)
+		if index.Server == "" {
+			problems = append(problems, path+".server is required")
+		}
+
+		for _, field := range index.Fields {
+			if _, err := parseStatIndexField(field); err != nil {
+				problems = append(problems, path+": "+err.Error())
+			}
+		}
+	}
+
+	return problems
+}
+
+// statIndexPaths returns the stat paths indexed on a season by configuration.
+func statIndexPaths(indexes []StatIndexConfig, season ServerIdentifier) []string {
+	paths := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, index := range indexes {
+		if !index.matches(season) {
+			continue
+		}
+
+		for _, value := range index.Fields {
+			field, err := parseStatIndexField(value)
+			if err != nil {
+				continue
+			}
+
+			if path := field.GetFullPath(); !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return paths
+}
+
+// preparedSeasons remembers seasons whose indexes have been created or are being built,
+// so they are only created once per process.
+var preparedSeasons sync.Map
+
+// prepareSeason creates the indexes of a season when its players are first stored by this process.
+// Indexes of a new collection are created before the insert, which is quick while it is empty.
+// Existing collections may take a while, so they are built in the background without a deadline.
+// Failures are logged and not retried until the next start, a missing index must not block updates.
+func prepareSeason(ctx context.Context, r *http.Request, season ServerIdentifier) {
+	if _, prepared := preparedSeasons.LoadOrStore(season, true); prepared {
+		return
+	}
+
+	paths := statIndexPaths(CurrentSettings().StatIndexes, season)
+	if exists, err := database.CollectionExists(ctx, season.String()); err == nil && !exists {
+		if err := database.EnsurePlayerIndexes(ctx, season.String(), paths); err != nil {
+			RequestLog(r).Error("Unable to create season indexes", "server", season.String(), "error", err)
+		}
+
+		return
+	}
+
+	logger := RequestLog(r)
+	go func() {
+		if err := database.EnsurePlayerIndexes(context.Background(), season.String(), paths); err != nil {
+			logger.Error("Unable to create season indexes", "server", season.String(), "error", err)
+		}
+	}()
+}
+
+// EnsureSeasonIndexes creates missing indexes of every existing season. A failing season is
+// logged and skipped, its indexes are retried on the next start or by the indexes command.
+func EnsureSeasonIndexes(ctx context.Context, indexes []StatIndexConfig) error {
+	seasons, err := ListSeasons(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, season := range seasons {
+		// A season whose first player came in meanwhile is already being built
+		if _, prepared := preparedSeasons.LoadOrStore(season, true); prepared {
+			continue
+		}
+
+		err = database.EnsurePlayerIndexes(ctx, season.String(), statIndexPaths(indexes, season))
+		if err != nil {
+			slog.Error("Unable to create season indexes", "server", season.String(), "error", err)
+		}
+	}
+
+	return nil
+}
+
+// RunIndexesCommand manages stat indexes of seasons: indexes list|build|drop.
+// Index builds may take a while on large seasons, so the commands have no deadline.
+func RunIndexesCommand(config *Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: indexes list|build|drop [flags]")
+	}
+
+	flags := flag.NewFlagSet("indexes "+args[0], flag.ContinueOnError)
+	server := flags.String("server", "*", "season like survival_5, server name like survival, or * for every season")
+	field := flags.String("field", "", "stat field like minecraft:custom/minecraft:play_time, defaults to configured fields")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	seasons, err := ListSeasons(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := StatIndexConfig{Server: *server}
+	indexes := config.Indexes
+	if *field != "" {
+		indexes = []StatIndexConfig{{Server: *server, Fields: []string{*field}}}
+		if _, err := parseStatIndexField(*field); err != nil {
+			return err
+		}
+	}
+
+	for _, season := range seasons {
+		if !target.matches(season) {
+			continue
+		}
+
+		switch args[0] {
+		case "list":
+			existing, err := database.ListStatIndexes(ctx, season.String())
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s\tindexed=%s\tconfigured=%s\n", season, strings.Join(existing, ","),
+				strings.Join(statIndexPaths(config.Indexes, season), ","))
+		case "build":
+			paths := statIndexPaths(indexes, season)
+			err = database.EnsurePlayerIndexes(ctx, season.String(), paths)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Built indexes of", season, "on", len(paths), "stat fields")
+		case "drop":
+			if *field == "" {
+				return errors.New("field is required to drop an index")
+			}
+
+			parsed, _ := parseStatIndexField(*field)
+			dropped, err := database.DropStatIndex(ctx, season.String(), parsed.GetFullPath())
+			if err != nil {
+				return err
+			}
+
+			if dropped {
+				fmt.Println("Dropped index of", *field, "on", season)
+			}
+		default:
+			return fmt.Errorf("unknown indexes command %q", args[0])
+		}
+	}
+
+	return nil
+}
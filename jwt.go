@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultJWTRolesClaim = "roles"
+
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWTVerifier validates tokens issued by our SSO and maps their roles to key scopes.
+type JWTVerifier struct {
+	Issuer     string
+	Audience   string
+	RolesClaim string
+	// RoleScopes maps role names to scopes, roles without a mapping grant nothing
+	RoleScopes map[string][]string
+	// Keys are verification keys by key id, the key with an empty id is used for tokens without kid
+	Keys map[string]any
+}
+
+// JWTConfig enables tokens of our SSO when the issuer is set. Keys come from a JWKS file,
+// a PEM public key file or both.
+type JWTConfig struct {
+	Issuer     string `yaml:"issuer"`
+	Audience   string `yaml:"audience"`
+	RolesClaim string `yaml:"rolesClaim"`
+	// RoleScopes maps role names to scopes, roles without a mapping grant nothing
+	RoleScopes    map[string][]string `yaml:"roleScopes"`
+	JWKSFile      string              `yaml:"jwksFile"`
+	PublicKeyFile string              `yaml:"publicKeyFile"`
+}
+
+func DefaultJWTConfig() JWTConfig {
+	return JWTConfig{RolesClaim: defaultJWTRolesClaim, RoleScopes: make(map[string][]string)}
+}
+
+// applyEnv overrides the settings with JWT_* variables.
+func (c *JWTConfig) applyEnv(env *envReader) {
+	c.Issuer = env.String("JWT_ISSUER", c.Issuer)
+	c.Audience = env.String("JWT_AUDIENCE", c.Audience)
+	c.RolesClaim = env.String("JWT_ROLES_CLAIM", c.RolesClaim)
+	if value, ok := os.LookupEnv("JWT_ROLE_SCOPES"); ok {
+		c.RoleScopes = ParseRoleScopes(value)
+	}
+
+	c.JWKSFile = env.String("JWT_JWKS_FILE", c.JWKSFile)
+	c.PublicKeyFile = env.String("JWT_PUBLIC_KEY_FILE", c.PublicKeyFile)
+}
+
+// validate loads the keys as well, so unreadable key files are reported by --check-config.
+func (c *JWTConfig) validate() []string {
+	problems := make([]string, 0)
+	if c.Issuer != "" && c.Audience == "" {
+		problems = append(problems, "auth.jwt.audience is required with an issuer, tokens issued for other services would be accepted")
+	}
+
+	roles := make([]string, 0, len(c.RoleScopes))
+	for role := range c.RoleScopes {
+		roles = append(roles, role)
+	}
+
+	sort.Strings(roles)
+	for _, role := range roles {
+		path := fmt.Sprintf("auth.jwt.roleScopes[%s]", role)
+		if err := validateScopes(c.RoleScopes[role]); err != nil {
+			problems = append(problems, path+": "+err.Error())
+		}
+
+		if (&database.APIKey{Scopes: c.RoleScopes[role]}).HasScope(ScopeUpdate) {
+			problems = append(problems, path+": the update scope is only granted to keys")
+		}
+	}
+
+	if c.Audience != "" {
+		if _, err := c.Verifier(); err != nil {
+			problems = append(problems, "auth.jwt: "+err.Error())
+		}
+	}
+
+	return problems
+}
+
+// Verifier loads the keys and returns the verifier, it returns nil if the issuer is not set.
+func (c *JWTConfig) Verifier() (*JWTVerifier, error) {
+	if c.Issuer == "" {
+		return nil, nil
+	}
+
+	verifier := &JWTVerifier{
+		Issuer:     c.Issuer,
+		Audience:   c.Audience,
+		RolesClaim: c.RolesClaim,
+		RoleScopes: c.RoleScopes,
+		Keys:       make(map[string]any),
+	}
+
+	if verifier.RolesClaim == "" {
+		verifier.RolesClaim = defaultJWTRolesClaim
+	}
+
+	if c.JWKSFile != "" {
+		err := verifier.LoadJWKSFile(c.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.PublicKeyFile != "" {
+		err := verifier.LoadPublicKeyFile(c.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(verifier.Keys) == 0 {
+		return nil, errors.New("issuer is set, but neither jwksFile nor publicKeyFile provide keys")
+	}
+
+	if verifier.Audience == "" {
+		return nil, errors.New("issuer is set without an audience")
+	}
+
+	return verifier, nil
+}
+
+// ParseRoleScopes parses mappings like "staff=limit_expansion;owner=admin,limit_expansion".
+func ParseRoleScopes(value string) map[string][]string {
+	result := make(map[string][]string)
+	for _, mapping := range strings.Split(value, ";") {
+		role, scopes, found := strings.Cut(mapping, "=")
+		if role = strings.TrimSpace(role); !found || role == "" {
+			continue
+		}
+
+		result[role] = splitList(scopes)
+	}
+
+	return result
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// LoadJWKSFile adds signing keys from a JSON Web Key Set, like the one published by the SSO.
+func (v *JWTVerifier) LoadJWKSFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	err = json.Unmarshal(content, &set)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := key.publicKey()
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key.KeyID, err)
+		}
+
+		v.Keys[key.KeyID] = publicKey
+	}
+
+	return nil
+}
+
+// LoadPublicKeyFile adds a PEM encoded public key or certificate used for tokens without kid.
+func (v *JWTVerifier) LoadPublicKeyFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return errors.New("no PEM data in " + path)
+	}
+
+	if block.Type == "CERTIFICATE" {
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+
+		v.Keys[""] = certificate.PublicKey
+		return nil
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	v.Keys[""] = publicKey
+	return nil
+}
+
+func (v *JWTVerifier) keyFunc(token *jwt.Token) (any, error) {
+	keyID, _ := token.Header["kid"].(string)
+	if key, ok := v.Keys[keyID]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", keyID)
+}
+
+func (v *JWTVerifier) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithIssuer(v.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+		jwt.WithAudience(v.Audience),
+	}
+
+	return options
+}
+
+// scopesOf collects scopes mapped to roles of the roles claim, which may be a list or a single string.
+// Roles are named by the SSO, so only mapped roles grant scopes, and never the update scope:
+// tokens are accepted for every server, only keys may update stats.
+func (v *JWTVerifier) scopesOf(claims jwt.MapClaims) []string {
+	var roles []string
+	switch value := claims[v.RolesClaim].(type) {
+	case string:
+		roles = []string{value}
+	case []any:
+		for _, role := range value {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	granted := make(map[string]bool)
+	scopes := make([]string, 0)
+	grant := func(scope string) {
+		if !granted[scope] {
+			granted[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	for _, role := range roles {
+		for _, scope := range v.RoleScopes[role] {
+			if scope != ScopeUpdate {
+				grant(scope)
+			}
+		}
+	}
+
+	return scopes
+}
+
+// Verify validates a token and returns a key describing its subject. Staff tokens aren't limited
+// to servers, which is safe as long as they can't get the update scope.
+func (v *JWTVerifier) Verify(token string) (*database.APIKey, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, v.keyFunc, v.parserOptions()...)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return &database.APIKey{
+		Name:    "jwt:" + subject,
+		Servers: []string{"*"},
+		Scopes:  v.scopesOf(claims),
+	}, nil
+}
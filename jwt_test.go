@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testVerifier(t *testing.T) (*JWTVerifier, *ecdsa.PrivateKey) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := &JWTVerifier{
+		Issuer:     "https://sso.bortexel.ru",
+		Audience:   "stats",
+		RolesClaim: defaultJWTRolesClaim,
+		RoleScopes: map[string][]string{"staff": {ScopeLimitExpansion, ScopeUpdate}},
+		Keys:       map[string]any{"": &privateKey.PublicKey},
+	}
+
+	return verifier, privateKey
+}
+
+func signToken(t *testing.T, privateKey *ecdsa.PrivateKey, audience string, roles ...string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":   "https://sso.bortexel.ru",
+		"aud":   audience,
+		"sub":   "player",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": roles,
+	}).SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestJWTGrantsOnlyMappedScopes(t *testing.T) {
+	verifier, privateKey := testVerifier(t)
+
+	key, err := verifier.Verify(signToken(t, privateKey, "stats", ScopeAdmin, ScopeUpdate, "staff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(key.Scopes, []string{ScopeLimitExpansion}) {
+		t.Fatalf("expected only the mapped limit expansion scope, got %v", key.Scopes)
+	}
+}
+
+func TestJWTRejectsOtherAudiences(t *testing.T) {
+	verifier, privateKey := testVerifier(t)
+
+	if _, err := verifier.Verify(signToken(t, privateKey, "wiki", "staff")); err == nil {
+		t.Fatal("token issued for another audience was accepted")
+	}
+}
+
+func TestJWTConfigValidate(t *testing.T) {
+	config := JWTConfig{
+		Issuer:     "https://sso.bortexel.ru",
+		RoleScopes: map[string][]string{"owner": {ScopeAdmin, ScopeUpdate}},
+	}
+
+	problems := strings.Join(config.validate(), "\n")
+	for _, expected := range []string{"auth.jwt.audience is required", "auth.jwt.roleScopes[owner]: the update scope"} {
+		if !strings.Contains(problems, expected) {
+			t.Fatalf("expected %q among problems:\n%s", expected, problems)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+const (
+	ScopeUpdate         = "update"
+	ScopeAdmin          = "admin"
+	ScopeLimitExpansion = "limit_expansion"
+	ScopeUnlimited      = "unlimited"
+)
+
+var knownScopes = []string{ScopeUpdate, ScopeAdmin, ScopeLimitExpansion, ScopeUnlimited}
+
+// KeyConfig is a key defined in the config file rather than the key store. Either the secret
+// or its hash is set, the hash keeps the secret out of the file. PublicKey is the hex-encoded
+// Ed25519 public key of a key that signs requests.
+type KeyConfig struct {
+	Name      string   `yaml:"name"`
+	Secret    string   `yaml:"secret"`
+	Hash      string   `yaml:"hash"`
+	PublicKey string   `yaml:"publicKey"`
+	Servers   []string `yaml:"servers"`
+	Scopes    []string `yaml:"scopes"`
+}
+
+func (c KeyConfig) APIKey() *database.APIKey {
+	hash := strings.ToLower(c.Hash)
+	if c.Secret != "" {
+		hash = HashKey(c.Secret)
+	}
+
+	return &database.APIKey{
+		Name:      c.Name,
+		Hash:      hash,
+		PublicKey: strings.ToLower(c.PublicKey),
+		Servers:   c.Servers,
+		Scopes:    c.Scopes,
+	}
+}
+
+func (c KeyConfig) validate(path string) []string {
+	problems := make([]string, 0)
+	if c.Name == "" {
+		problems = append(problems, path+".name is required")
+	}
+
+	if (c.Secret == "") == (c.Hash == "") {
+		problems = append(problems, path+" needs either a secret or a hash")
+	} else if decoded, err := hex.DecodeString(c.Hash); c.Hash != "" && (err != nil || len(decoded) != sha256.Size) {
+		problems = append(problems, path+".hash must be a hex-encoded SHA-256 hash")
+	}
+
+	if c.PublicKey != "" && !isValidPublicKey(c.PublicKey) {
+		problems = append(problems, path+".publicKey must be a hex-encoded Ed25519 public key")
+	}
+
+	if len(c.Servers) == 0 || len(c.Scopes) == 0 {
+		problems = append(problems, path+" needs servers and scopes")
+	}
+
+	if err := validateScopes(c.Scopes); err != nil {
+		problems = append(problems, path+": "+err.Error())
+	}
+
+	return problems
+}
+
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func isValidPublicKey(publicKey string) bool {
+	decoded, err := hex.DecodeString(publicKey)
+	return err == nil && len(decoded) == ed25519.PublicKeySize
+}
+
+func GenerateKey() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// LookupKey finds the key matching a secret, it returns nil if the secret is unknown.
+func LookupKey(ctx context.Context, secret string) (*database.APIKey, error) {
+	hash := HashKey(secret)
+	for _, key := range CurrentSettings().Keys {
+		if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) == 1 {
+			return key, nil
+		}
+	}
+
+	// The store is queried by hash, so the lookup time doesn't depend on how much of the secret matches
+	return database.FindAPIKey(ctx, hash)
+}
+
+// LookupKeyByName finds a key by its name, it returns nil if there is no such key.
+func LookupKeyByName(ctx context.Context, name string) (*database.APIKey, error) {
+	for _, key := range CurrentSettings().Keys {
+		if key.Name == name {
+			return key, nil
+		}
+	}
+
+	return database.FindAPIKeyByName(ctx, name)
+}
+
+func splitList(value string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		known := false
+		for _, knownScope := range knownScopes {
+			known = known || scope == knownScope
+		}
+
+		if !known {
+			return fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(knownScopes, ", "))
+		}
+	}
+
+	return nil
+}
+
+// RunKeysCommand manages the key store: keys create|list|revoke.
+func RunKeysCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: keys create|list|revoke [flags]")
+	}
+
+	ctx, cancel := BackgroundContext(OperationWrite)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		name := flags.String("name", "", "unique key name")
+		servers := flags.String("servers", "", "comma-separated servers like survival_5, or * for every server")
+		scopes := flags.String("scopes", ScopeUpdate, "comma-separated scopes: "+strings.Join(knownScopes, ", "))
+		publicKey := flags.String("public-key", "", "hex-encoded Ed25519 public key for signed requests")
+		signing := flags.Bool("signing", false, "generate an Ed25519 key pair for signed requests")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		key := &database.APIKey{
+			Name:      *name,
+			Servers:   splitList(*servers),
+			Scopes:    splitList(*scopes),
+			CreatedAt: time.Now(),
+		}
+
+		if key.Name == "" || len(key.Servers) == 0 || len(key.Scopes) == 0 {
+			return errors.New("name, servers and scopes are required")
+		}
+
+		if err := validateScopes(key.Scopes); err != nil {
+			return err
+		}
+
+		if *publicKey != "" && (*signing || !isValidPublicKey(*publicKey)) {
+			return errors.New("public-key must be a hex-encoded Ed25519 public key and can't be combined with signing")
+		}
+
+		secret, err := GenerateKey()
+		if err != nil {
+			return err
+		}
+
+		var privateKey ed25519.PrivateKey
+		key.PublicKey = strings.ToLower(*publicKey)
+		if *signing {
+			var generated ed25519.PublicKey
+			generated, privateKey, err = ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return err
+			}
+
+			key.PublicKey = hex.EncodeToString(generated)
+		}
+
+		key.Hash = HashKey(secret)
+		if err := database.InsertAPIKey(ctx, key); err != nil {
+			return err
+		}
+
+		fmt.Println("Created key", key.Name, "- it won't be shown again:")
+		fmt.Println(secret)
+		if privateKey != nil {
+			fmt.Println("Ed25519 private key for signed requests, the server only keeps the public key:")
+			fmt.Println(hex.EncodeToString(privateKey))
+		}
+	case "list":
+		keys, err := database.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			fmt.Printf("%s\tservers=%s\tscopes=%s\tsigning=%t\tcreated=%s\n", key.Name, strings.Join(key.Servers, ","),
+				strings.Join(key.Scopes, ","), key.PublicKey != "", key.CreatedAt.Format(time.RFC3339))
+		}
+	case "revoke":
+		flags := flag.NewFlagSet("keys revoke", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the key to revoke")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		deleted, err := database.DeleteAPIKey(ctx, *name)
+		if err != nil {
+			return err
+		}
+
+		if !deleted {
+			return fmt.Errorf("key %q does not exist", *name)
+		}
+
+		fmt.Println("Revoked key", *name)
+	default:
+		return fmt.Errorf("unknown keys command %q", args[0])
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+const (
+	defaultAuthFailureThreshold = 10
+	defaultAuthFailureWindow    = 10 * time.Minute
+	defaultAuthLockoutDuration  = 15 * time.Minute
+)
+
+var ErrLockedOut = errors.New("too many failed authentication attempts")
+
+// TrustedProxyHops is the number of proxies in front of the server whose X-Forwarded-For entries
+// are trusted, zero ignores the header. It is set on startup from the http config.
+var TrustedProxyHops int
+
+// ClientIP returns the address of the client. Proxies append the address they received a request
+// from to X-Forwarded-For, so only the entries added by our own proxies are trusted: counting them
+// from the right, the last trusted proxy wrote the address of the client. Entries further to the
+// left are written by the client itself, trusting them would let anyone pick an address to hide behind.
+func ClientIP(r *http.Request) string {
+	if TrustedProxyHops > 0 {
+		if entries := forwardedFor(r); len(entries) > 0 {
+			if len(entries) < TrustedProxyHops {
+				return entries[0]
+			}
+
+			return entries[len(entries)-TrustedProxyHops]
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// forwardedFor returns the X-Forwarded-For entries of every header line in order.
+func forwardedFor(r *http.Request) []string {
+	entries := make([]string, 0)
+	for _, line := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(line, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries
+}
+
+type authFailures struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// AuthFailureTracker counts failed authentication attempts per IP and locks out IPs that
+// exceed the threshold within the window.
+type AuthFailureTracker struct {
+	mu        sync.Mutex
+	failures  map[string]*authFailures
+	threshold int
+	window    time.Duration
+	lockout   time.Duration
+}
+
+func NewAuthFailureTracker(threshold int, window time.Duration, lockout time.Duration) *AuthFailureTracker {
+	return &AuthFailureTracker{
+		failures:  make(map[string]*authFailures),
+		threshold: threshold,
+		window:    window,
+		lockout:   lockout,
+	}
+}
+
+// LockedFor returns how long the IP stays locked out, zero if it isn't.
+func (t *AuthFailureTracker) LockedFor(ip string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.failures[ip]
+	if !ok || !now.Before(entry.lockedUntil) {
+		return 0
+	}
+
+	return entry.lockedUntil.Sub(now)
+}
+
+// Fail records a failed attempt and returns the number of failures in the current window
+// and whether the IP got locked out by it.
+func (t *AuthFailureTracker) Fail(ip string, now time.Time) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for currentIP, entry := range t.failures {
+		if now.Sub(entry.windowStart) > t.window && now.After(entry.lockedUntil) {
+			delete(t.failures, currentIP)
+		}
+	}
+
+	entry, ok := t.failures[ip]
+	if !ok {
+		entry = &authFailures{windowStart: now}
+		t.failures[ip] = entry
+	}
+
+	entry.count++
+	if t.threshold > 0 && entry.count >= t.threshold {
+		entry.count = 0
+		entry.windowStart = now
+		entry.lockedUntil = now.Add(t.lockout)
+		return t.threshold, true
+	}
+
+	return entry.count, false
+}
+
+// LockoutConfig locks out IPs after threshold failed attempts within the window,
+// a non-positive threshold disables the lockout.
+type LockoutConfig struct {
+	Threshold int           `yaml:"threshold"`
+	Window    time.Duration `yaml:"window"`
+	Duration  time.Duration `yaml:"duration"`
+}
+
+func DefaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		Threshold: defaultAuthFailureThreshold,
+		Window:    defaultAuthFailureWindow,
+		Duration:  defaultAuthLockoutDuration,
+	}
+}
+
+// applyEnv overrides the lockout with AUTH_* variables.
+func (c *LockoutConfig) applyEnv(env *envReader) {
+	c.Threshold = env.Int("AUTH_FAILURE_THRESHOLD", c.Threshold)
+	c.Window = env.Duration("AUTH_FAILURE_WINDOW", c.Window)
+	c.Duration = env.Duration("AUTH_LOCKOUT_DURATION", c.Duration)
+}
+
+func (c *LockoutConfig) validate() []string {
+	problems := make([]string, 0)
+	if c.Threshold > 0 && (c.Window <= 0 || c.Duration <= 0) {
+		problems = append(problems, "auth.lockout.window and auth.lockout.duration must be positive")
+	}
+
+	return problems
+}
+
+// checkLockout rejects requests from locked out IPs with a Retry-After header.
+func checkLockout(r *http.Request) (any, error, int) {
+	lockedFor := CurrentSettings().AuthFailures.LockedFor(ClientIP(r), time.Now())
+	if lockedFor <= 0 {
+		return nil, nil, 0
+	}
+
+	header := make(http.Header)
+	header.Set("Retry-After", strconv.Itoa(int(lockedFor.Seconds())+1))
+	return nil, &HeaderError{Err: ErrLockedOut, Header: header}, http.StatusTooManyRequests
+}
+
+// recordAuthenticationFailure logs a failed attempt and counts it towards the lockout of the IP.
+// Only invalid credentials count, a valid key used beyond its scopes is just denied.
+func recordAuthenticationFailure(r *http.Request, reason error) {
+	ip := ClientIP(r)
+	failures, locked := CurrentSettings().AuthFailures.Fail(ip, time.Now())
+
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	RequestLog(r).Warn("Authentication failed", "ip", ip, "method", r.Method, "path", r.URL.Path,
+		"scheme", scheme, "reason", reason, "failures", failures, "locked", locked)
+}
+
+// logAuthorizationDenied logs a valid key that was denied. It doesn't count towards the lockout,
+// otherwise one misconfigured key would lock out every key of its host.
+func logAuthorizationDenied(r *http.Request, key *database.APIKey, reason error) {
+	RequestLog(r).Warn("Authorization denied", "ip", ClientIP(r), "method", r.Method, "path", r.URL.Path,
+		"key", key.Name, "reason", reason)
+}
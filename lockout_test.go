@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func useTrustedProxyHops(t *testing.T, hops int) {
+	previous := TrustedProxyHops
+	TrustedProxyHops = hops
+	t.Cleanup(func() { TrustedProxyHops = previous })
+}
+
+func forwardedRequest(forwardedFor ...string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/health", nil)
+	r.RemoteAddr = "10.0.0.2:41000"
+	for _, value := range forwardedFor {
+		r.Header.Add("X-Forwarded-For", value)
+	}
+
+	return r
+}
+
+func TestClientIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	useTrustedProxyHops(t, 1)
+
+	// The client wrote the first entry, our proxy appended the address it connected from
+	r := forwardedRequest("1.2.3.4, 5.6.7.8", "203.0.113.7")
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected the address appended by the proxy, got %s", ip)
+	}
+}
+
+func TestClientIPCountsTrustedHops(t *testing.T) {
+	useTrustedProxyHops(t, 2)
+
+	r := forwardedRequest("1.2.3.4, 203.0.113.7, 10.0.0.1")
+	if ip := ClientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("expected the address before the trusted hops, got %s", ip)
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	useTrustedProxyHops(t, 0)
+
+	if ip := ClientIP(forwardedRequest("203.0.113.7")); ip != "10.0.0.2" {
+		t.Fatalf("expected the remote address, got %s", ip)
+	}
+}
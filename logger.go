@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// logLevel is shared by every handler installed by LoggingConfig.Apply, so HandleLogLevel
+// can change it without replacing the handler.
+var logLevel = new(slog.LevelVar)
+
+func init() {
+	DefaultLoggingConfig().Apply()
+}
+
+// ParseLogLevel accepts the level names of slog, like debug, info, warn and error.
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+
+	return level, nil
+}
+
+func logLevelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// fatal logs an error and exits.
+func fatal(message string, args ...any) {
+	slog.Error(message, args...)
+	os.Exit(1)
+}
+
+type LoggingConfig struct {
+	Level string `yaml:"level"`
+	// Format is either "text" or "json"
+	Format string `yaml:"format"`
+}
+
+func DefaultLoggingConfig() LoggingConfig {
+	return LoggingConfig{Level: logLevelName(slog.LevelInfo), Format: "text"}
+}
+
+// applyEnv overrides the logging settings with LOG_LEVEL and LOG_FORMAT.
+func (c *LoggingConfig) applyEnv(env *envReader) {
+	c.Level = env.String("LOG_LEVEL", c.Level)
+	c.Format = env.String("LOG_FORMAT", c.Format)
+}
+
+func (c *LoggingConfig) validate() []string {
+	problems := make([]string, 0)
+	if _, err := ParseLogLevel(c.Level); err != nil {
+		problems = append(problems, "logging.level: "+err.Error())
+	}
+
+	if c.Format != "text" && c.Format != "json" {
+		problems = append(problems, fmt.Sprintf("logging.format must be text or json, got %q", c.Format))
+	}
+
+	return problems
+}
+
+// Apply configures the default logger, the config is expected to be validated.
+func (c LoggingConfig) Apply() {
+	level, _ := ParseLogLevel(c.Level)
+	logLevel.Set(level)
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	if c.Format == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, options)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, options)))
+	}
+}
+
+const (
+	RequestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 64
+)
+
+// RequestInfo is shared by every handler of a request, so the access log sees what they found out.
+type RequestInfo struct {
+	ID      string
+	KeyName string
+}
+
+func requestInfo(r *http.Request) *RequestInfo {
+	info, _ := r.Context().Value(requestInfoContextKey).(*RequestInfo)
+	if info == nil {
+		return &RequestInfo{}
+	}
+
+	return info
+}
+
+// RequestID returns the ID assigned to the request by MainHandler.
+func RequestID(r *http.Request) string {
+	return requestInfo(r).ID
+}
+
+// RequestLog returns a logger that tags entries with the request ID.
+func RequestLog(r *http.Request) *slog.Logger {
+	return slog.With("requestId", RequestID(r))
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, char := range id {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || strings.ContainsRune("-_.:", char)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withRequestInfo assigns an ID to the request, an ID set by a proxy in front of the server is kept.
+func withRequestInfo(r *http.Request) (*http.Request, *RequestInfo) {
+	info := &RequestInfo{ID: r.Header.Get(RequestIDHeader)}
+	if !isValidRequestID(info.ID) {
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+		info.ID = hex.EncodeToString(id)
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), requestInfoContextKey, info)), info
+}
+
+// logAccess writes the access log entry of a request. Failed requests are logged with a higher level.
+func logAccess(r *http.Request, action string, status int, duration time.Duration, err error) {
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case err != nil:
+		level = slog.LevelWarn
+	}
+
+	fields := []any{
+		"method", r.Method,
+		"path", r.URL.Path,
+		"action", action,
+		"status", status,
+		"durationMs", float64(duration.Microseconds()) / 1000,
+		"ip", ClientIP(r),
+	}
+
+	if keyName := requestInfo(r).KeyName; keyName != "" {
+		fields = append(fields, "key", keyName)
+	}
+
+	if err != nil {
+		fields = append(fields, "error", err)
+	}
+
+	RequestLog(r).Log(r.Context(), level, "Request served", fields...)
+}
+
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// HandleLogLevel changes the log level at runtime, an empty level only reports the current one.
+// The configured level is restored when the configuration is reloaded.
+func HandleLogLevel(r *http.Request, body []byte) (any, error, int) {
+	var request LogLevelRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	if request.Level != "" {
+		level, err := ParseLogLevel(request.Level)
+		if err != nil {
+			return nil, err, http.StatusUnprocessableEntity
+		}
+
+		RequestLog(r).Info("Log level changed", "level", logLevelName(level), "key", requestInfo(r).KeyName)
+		logLevel.Set(level)
+	}
+
+	return &LogLevelRequest{Level: logLevelName(logLevel.Level())}, nil, http.StatusOK
+}
@@ -1,46 +1,190 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/bortexel/stats-server/database"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-const defaultBindAddr = ":8080"
+const databaseDisconnectTimeout = 5 * time.Second
 
 var ConfiguredAuthorizationMiddleware func(ActionHandler) ActionHandler
 
 func main() {
-	uri, ok := os.LookupEnv("MONGO_CONNECTION_URI")
-	if !ok {
-		log.Fatalln("MONGO_CONNECTION_URI variable is empty")
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("CONFIG_FILE"), "path to the YAML config file, environment variables override it")
+	checkConfig := flags.Bool("check-config", false, "validate the configuration and exit")
+	_ = flags.Parse(os.Args[1:])
+
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		var configError *ConfigError
+		if errors.As(err, &configError) {
+			for _, problem := range configError.Problems {
+				slog.Error("Configuration problem", "problem", problem)
+			}
+
+			fatal("Configuration is invalid")
+		}
+
+		fatal("Unable to load configuration", "error", err)
+	}
+
+	config.Logging.Apply()
+
+	if *checkConfig {
+		slog.Info("Configuration is valid")
 		return
 	}
 
-	err := database.InitDatabase(uri)
+	config.Storage.Timeouts.Apply()
+	ServerStatisticsCache = NewAggregateCache(config.Storage.AggregateCacheTTL)
+	if config.HTTP.TrustProxyHeaders {
+		TrustedProxyHops = config.HTTP.ProxyHops
+	}
+
+	err = database.InitDatabase(config.Storage.URI, config.Storage.Database)
 	if err != nil {
-		log.Println("Unable to init database:", err)
+		slog.Error("Unable to init database", "error", err)
 		return
 	}
 
-	bindAddr := os.Getenv("BIND_ADDR")
-	if bindAddr == "" {
-		bindAddr = defaultBindAddr
+	indexCtx, cancel := BackgroundContext(OperationAggregate)
+	err = database.EnsureIndexes(indexCtx)
+	cancel()
+	if err != nil {
+		slog.Error("Unable to create indexes", "error", err)
 	}
 
-	key, ok := os.LookupEnv("MUTATION_KEY")
-	if !ok {
-		log.Fatalln("MUTATION_KEY is not set")
-	} else {
-		ConfiguredAuthorizationMiddleware = Authorization(key)
+	if args := flags.Args(); len(args) > 0 {
+		switch args[0] {
+		case "keys":
+			err = RunKeysCommand(args[1:])
+		case "indexes":
+			err = RunIndexesCommand(config, args[1:])
+		default:
+			err = fmt.Errorf("unknown command %q, expected keys or indexes", args[0])
+		}
+
+		if err != nil {
+			fatal("Command failed", "command", args[0], "error", err)
+		}
+
+		return
 	}
 
-	log.Println("Starting HTTP server listener on", bindAddr)
-	err = http.ListenAndServe(bindAddr, http.HandlerFunc(MainHandler))
+	err = ApplyConfig(config)
 	if err != nil {
-		log.Fatalln("Error serving HTTP", err)
-		return
+		fatal("Unable to apply configuration", "error", err)
+	}
+
+	if config.Auth.MutationKey == "" {
+		slog.Info("MUTATION_KEY is not set, only configured keys and keys from the key store are accepted")
+	}
+
+	var tracerProvider *sdktrace.TracerProvider
+	if config.Tracing.Endpoint != "" {
+		tracerProvider, err = NewTracerProvider(context.Background(), config.Tracing)
+		if err != nil {
+			fatal("Unable to configure tracing", "error", err)
+		}
+
+		otel.SetTracerProvider(tracerProvider)
+		slog.Info("Exporting traces", "endpoint", config.Tracing.Endpoint, "sampleRatio", config.Tracing.SampleRatio)
+	}
+
+	ConfiguredAuthorizationMiddleware = Authorization(ScopeUpdate)
+
+	// Builds on large seasons may take a while, the server doesn't have to wait for them.
+	// Like the indexes command, they have no deadline, an aggregate timeout would cut them off.
+	go func() {
+		if err := EnsureSeasonIndexes(context.Background(), config.Indexes); err != nil {
+			slog.Error("Unable to create season indexes", "error", err)
+		}
+	}()
+
+	server := &http.Server{
+		Addr:              config.HTTP.BindAddr,
+		Handler:           http.HandlerFunc(MainHandler),
+		ReadHeaderTimeout: config.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       config.HTTP.ReadTimeout,
+		WriteTimeout:      config.HTTP.WriteTimeout,
+		IdleTimeout:       config.HTTP.IdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	go WatchConfig(ctx, *configPath, config, config.Reload.WatchInterval)
+
+	serveErrors := make(chan error, 2)
+	go func() {
+		slog.Info("Starting HTTP server listener", "addr", config.HTTP.BindAddr)
+		serveErrors <- server.ListenAndServe()
+	}()
+
+	var metricsServer *http.Server
+	if config.HTTP.MetricsBindAddr != "" {
+		metricsServer = NewMetricsServer(config.HTTP)
+		go func() {
+			slog.Info("Starting metrics listener", "addr", config.HTTP.MetricsBindAddr)
+			serveErrors <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-serveErrors:
+		slog.Error("Error serving HTTP", "error", serveErr)
+	case <-ctx.Done():
+		stop()
+		slog.Info("Shutting down, waiting for in-flight requests")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), config.HTTP.ShutdownTimeout)
+		defer cancel()
+
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			slog.Error("Unable to shut down gracefully", "error", err)
+		}
+	}
+
+	if metricsServer != nil {
+		if err := metricsServer.Close(); err != nil {
+			slog.Error("Unable to close metrics listener", "error", err)
+		}
+	}
+
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), databaseDisconnectTimeout)
+	defer cancel()
+
+	err = database.Client.Disconnect(disconnectCtx)
+	if err != nil {
+		slog.Error("Unable to disconnect from database", "error", err)
+	}
+
+	if tracerProvider != nil {
+		tracerCtx, cancel := context.WithTimeout(context.Background(), tracingExportTimeout)
+		defer cancel()
+
+		if err := tracerProvider.Shutdown(tracerCtx); err != nil {
+			slog.Error("Unable to export remaining spans", "error", err)
+		}
+	}
+
+	if serveErr != nil {
+		os.Exit(1)
 	}
 }
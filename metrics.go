@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stats_requests_total",
+		Help: "Number of handled requests by action and response status.",
+	}, []string{"action", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stats_request_duration_seconds",
+		Help:    "Time spent handling requests by action.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"action"})
+
+	databaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "stats_database_command_duration_seconds",
+		Help:    "Time spent on database commands by command name.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"command"})
+
+	databaseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stats_database_errors_total",
+		Help: "Number of failed database commands by command name.",
+	}, []string{"command"})
+)
+
+// seasonPlayersCollector reports the number of players per season on every scrape. It uses
+// estimated counts, which come from collection metadata rather than scanning documents.
+type seasonPlayersCollector struct {
+	description *prometheus.Desc
+}
+
+func newSeasonPlayersCollector() *seasonPlayersCollector {
+	return &seasonPlayersCollector{
+		description: prometheus.NewDesc("stats_season_players", "Number of players stored per season.",
+			[]string{"server", "season"}, nil),
+	}
+}
+
+func (c *seasonPlayersCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- c.description
+}
+
+func (c *seasonPlayersCollector) Collect(metrics chan<- prometheus.Metric) {
+	if database.Database == nil {
+		return
+	}
+
+	ctx, cancel := BackgroundContext(OperationRead)
+	defer cancel()
+
+	seasons, err := ListSeasons(ctx)
+	if err != nil {
+		slog.Error("Unable to list seasons for metrics", "error", err)
+		return
+	}
+
+	for _, season := range seasons {
+		count, err := database.Database.Collection(season.String()).EstimatedDocumentCount(ctx)
+		if err != nil {
+			slog.Error("Unable to count players for metrics", "server", season.String(), "error", err)
+			continue
+		}
+
+		metrics <- prometheus.MustNewConstMetric(c.description, prometheus.GaugeValue, float64(count),
+			season.ServerName, strconv.Itoa(season.Season))
+	}
+}
+
+var MetricsHandler = promhttp.Handler()
+
+// NewMetricsServer serves /metrics on its own address, scrapes aren't authenticated,
+// so keeping them off the API address keeps them away from clients.
+func NewMetricsServer(config HTTPConfig) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", MetricsHandler)
+
+	return &http.Server{
+		Addr:              config.MetricsBindAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, databaseDuration, databaseErrors, newSeasonPlayersCollector())
+
+	database.CommandObserver = func(command string, duration time.Duration, failed bool) {
+		databaseDuration.WithLabelValues(command).Observe(duration.Seconds())
+		if failed {
+			databaseErrors.WithLabelValues(command).Inc()
+		}
+	}
+}
+
+// ObserveRequest records a handled request of an action.
+func ObserveRequest(action string, status int, duration time.Duration) {
+	requestsTotal.WithLabelValues(action, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(action).Observe(duration.Seconds())
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/bortexel/stats-server/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListSeasons returns identifiers of every season collection, ordered by server name and season.
+func ListSeasons(ctx context.Context) ([]ServerIdentifier, error) {
+	names, err := database.Database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	seasons := make([]ServerIdentifier, 0, len(names))
+	for _, name := range names {
+		if identifier, ok := ParseServerIdentifier(name); ok {
+			seasons = append(seasons, identifier)
+		}
+	}
+
+	sort.Slice(seasons, func(i, j int) bool {
+		if seasons[i].ServerName != seasons[j].ServerName {
+			return seasons[i].ServerName < seasons[j].ServerName
+		}
+
+		return seasons[i].Season < seasons[j].Season
+	})
+
+	return seasons, nil
+}
+
+// resolveSeasons returns the requested seasons or every known season if none were requested.
+func resolveSeasons(ctx context.Context, requested []ServerIdentifier) ([]ServerIdentifier, error) {
+	existing, err := ListSeasons(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(requested) == 0 {
+		return existing, nil
+	}
+
+	return selectSeasons(requested, existing), nil
+}
+
+// selectSeasons keeps requested seasons that exist, each of them once and in the requested order.
+// Sums over seasons would count duplicates twice, and seasons that don't exist add nothing but
+// pipeline stages, so a request never gets more stages than there are seasons.
+func selectSeasons(requested []ServerIdentifier, existing []ServerIdentifier) []ServerIdentifier {
+	remaining := make(map[ServerIdentifier]bool, len(existing))
+	for _, season := range existing {
+		remaining[season] = true
+	}
+
+	selected := make([]ServerIdentifier, 0, len(existing))
+	for _, season := range requested {
+		if remaining[season] {
+			selected = append(selected, season)
+			delete(remaining, season)
+		}
+	}
+
+	return selected
+}
+
+// unionSeasons runs the stages on every season and combines their documents in a single pipeline,
+// so handlers work on all seasons at once instead of loading each of them into memory.
+func unionSeasons(seasons []ServerIdentifier, stages func(season ServerIdentifier) mongo.Pipeline) mongo.Pipeline {
+	pipeline := stages(seasons[0])
+	for _, season := range seasons[1:] {
+		pipeline = append(pipeline, bson.D{{Key: "$unionWith", Value: bson.M{
+			"coll":     season.String(),
+			"pipeline": stages(season),
+		}}})
+	}
+
+	return pipeline
+}
+
+// latestSeasonName is a projected value whose $max is the name of the player in their latest season.
+// The season list may come in any order, so the season number decides instead of the position.
+func latestSeasonName(season ServerIdentifier) bson.D {
+	return bson.D{
+		{Key: "season", Value: bson.M{"$literal": season.Season}},
+		{Key: "name", Value: "$name"},
+	}
+}
+
+type latestName struct {
+	Season int    `bson:"season"`
+	Name   string `bson:"name"`
+}
+
+type PlayerProfileRequest struct {
+	UUID        string             `json:"uuid"`
+	Seasons     []ServerIdentifier `json:"seasons"`
+	ReturnStats bool               `json:"returnStats"`
+}
+
+type SeasonSummary struct {
+	Server ServerIdentifier        `json:"server"`
+	Name   string                  `json:"name"`
+	Totals database.StatsMap       `json:"totals"`
+	Stats  database.StatsContainer `json:"stats,omitempty"`
+}
+
+type PlayerProfile struct {
+	UUID    string                  `json:"uuid"`
+	Name    string                  `json:"name"`
+	Seasons []*SeasonSummary        `json:"seasons"`
+	Totals  database.StatsMap       `json:"totals"`
+	Stats   database.StatsContainer `json:"stats,omitempty"`
+}
+
+func HandlePlayerProfile(r *http.Request, body []byte) (any, error, int) {
+	var request PlayerProfileRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	if request.UUID == "" {
+		return nil, errors.New("uuid is required"), http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	seasons, err := resolveSeasons(ctx, request.Seasons)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	allTime := database.MakeStatsContainer()
+	nameSeason := 0
+	profile := &PlayerProfile{
+		UUID:    request.UUID,
+		Seasons: make([]*SeasonSummary, 0),
+	}
+
+	for _, season := range seasons {
+		var player database.StoredPlayer
+		err := database.Database.Collection(season.String()).
+			FindOne(ctx, bson.D{{Key: "uuid", Value: request.UUID}}).Decode(&player)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+
+		if err != nil {
+			return databaseError(err)
+		}
+
+		summary := &SeasonSummary{
+			Server: season,
+			Name:   player.Name,
+			Totals: player.Stats[database.StatTotals],
+		}
+
+		if request.ReturnStats {
+			summary.Stats = player.Stats
+		}
+
+		// Names change between seasons, the one from the latest season wins
+		if profile.Name == "" || season.Season >= nameSeason {
+			profile.Name, nameSeason = player.Name, season.Season
+		}
+
+		profile.Seasons = append(profile.Seasons, summary)
+		allTime.Add(player.Stats)
+	}
+
+	if len(profile.Seasons) == 0 {
+		return nil, nil, http.StatusNotFound
+	}
+
+	profile.Totals = allTime[database.StatTotals]
+	if request.ReturnStats {
+		profile.Stats = allTime
+	}
+
+	return profile, nil, http.StatusOK
+}
+
+type AllTimeLeaderboardRequest struct {
+	Field             StatField          `json:"field"`
+	Direction         SortDirection      `json:"direction"`
+	Seasons           []ServerIdentifier `json:"seasons"`
+	LimitExpansionKey string             `json:"limitExpansionKey"`
+}
+
+type AllTimeLeaderboardEntry struct {
+	UUID    string  `json:"uuid"`
+	Name    string  `json:"name"`
+	Value   float64 `json:"value"`
+	Seasons int     `json:"seasons"`
+}
+
+type allTimeLeaderboardResult struct {
+	UUID    string     `bson:"_id"`
+	Value   float64    `bson:"value"`
+	Seasons int        `bson:"seasons"`
+	Latest  latestName `bson:"latest"`
+}
+
+func HandleAllTimeLeaderboard(r *http.Request, body []byte) (any, error, int) {
+	var request AllTimeLeaderboardRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	if request.Field.GroupName == "" || request.Field.FieldName == "" {
+		return nil, errors.New("field is required"), http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationAggregate)
+	defer cancel()
+
+	seasons, err := resolveSeasons(ctx, request.Seasons)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if len(seasons) == 0 {
+		return nil, nil, http.StatusNotFound
+	}
+
+	path := request.Field.GetFullPath()
+	direction := SortOptions{Direction: request.Direction}.GetDirection().getValue()
+	pipeline := unionSeasons(seasons, func(season ServerIdentifier) mongo.Pipeline {
+		return mongo.Pipeline{
+			{{Key: "$match", Value: bson.D{{Key: path, Value: bson.M{"$type": "number"}}}}},
+			{{Key: "$project", Value: bson.D{
+				{Key: "uuid", Value: 1},
+				{Key: "value", Value: "$" + path},
+				{Key: "latest", Value: latestSeasonName(season)},
+			}}},
+		}
+	})
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$uuid"},
+			{Key: "value", Value: bson.M{"$sum": "$value"}},
+			{Key: "seasons", Value: bson.M{"$sum": 1}},
+			{Key: "latest", Value: bson.M{"$max": "$latest"}},
+		}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "value", Value: direction}, {Key: "_id", Value: 1}}}},
+	)
+
+	if limit := getRecordLimit(r, "*", request.LimitExpansionKey); limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cursor, err := database.Database.Collection(seasons[0].String()).Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	var entries []*allTimeLeaderboardResult
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if len(entries) == 0 {
+		return nil, nil, http.StatusNotFound
+	}
+
+	results := make([]*AllTimeLeaderboardEntry, 0, len(entries))
+	for _, entry := range entries {
+		results = append(results, &AllTimeLeaderboardEntry{
+			UUID:    entry.UUID,
+			Name:    entry.Latest.Name,
+			Value:   entry.Value,
+			Seasons: entry.Seasons,
+		})
+	}
+
+	return results, nil, http.StatusOK
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectSeasons(t *testing.T) {
+	existing := []ServerIdentifier{{"creative", 1}, {"survival", 4}, {"survival", 5}}
+	requested := []ServerIdentifier{{"survival", 5}, {"survival", 5}, {"survival", 9}, {"creative", 1}, {"survival", 5}}
+
+	selected := selectSeasons(requested, existing)
+	expected := []ServerIdentifier{{"survival", 5}, {"creative", 1}}
+	if !reflect.DeepEqual(selected, expected) {
+		t.Fatalf("expected %v, got %v", expected, selected)
+	}
+}
+
+func TestSelectSeasonsIsBoundedByExistingSeasons(t *testing.T) {
+	existing := []ServerIdentifier{{"survival", 5}}
+	requested := make([]ServerIdentifier, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		requested = append(requested, ServerIdentifier{"survival", i})
+	}
+
+	if selected := selectSeasons(requested, existing); len(selected) != 1 {
+		t.Fatalf("expected only the existing season, got %d seasons", len(selected))
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitRate     = 2
+	defaultRateLimitBurst    = 20
+	defaultKeyRateLimitRate  = 10
+	defaultKeyRateLimitBurst = 100
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBucketLimiter allows rate requests per second on average with bursts of up to burst requests per client.
+type TokenBucketLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token of the client, if there is none it returns how long to wait for the next one.
+// A limiter with non-positive rate allows everything.
+func (l *TokenBucketLimiter) Allow(client string, now time.Time) (bool, time.Duration) {
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// prune forgets buckets that have refilled completely, they are equal to new ones anyway.
+func (l *TokenBucketLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+
+	l.pruned = now
+	refillTime := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, bucket := range l.buckets {
+		if now.Sub(bucket.last) > refillTime {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// RateLimitConfig sets requests per second and bursts, a non-positive rate disables the limit.
+type RateLimitConfig struct {
+	Rate     float64 `yaml:"rate"`
+	Burst    int     `yaml:"burst"`
+	KeyRate  float64 `yaml:"keyRate"`
+	KeyBurst int     `yaml:"keyBurst"`
+}
+
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Rate:     defaultRateLimitRate,
+		Burst:    defaultRateLimitBurst,
+		KeyRate:  defaultKeyRateLimitRate,
+		KeyBurst: defaultKeyRateLimitBurst,
+	}
+}
+
+// applyEnv overrides the limits with RATE_LIMIT_* variables.
+func (c *RateLimitConfig) applyEnv(env *envReader) {
+	c.Rate = env.Float("RATE_LIMIT_RATE", c.Rate)
+	c.Burst = env.Int("RATE_LIMIT_BURST", c.Burst)
+	c.KeyRate = env.Float("RATE_LIMIT_KEY_RATE", c.KeyRate)
+	c.KeyBurst = env.Int("RATE_LIMIT_KEY_BURST", c.KeyBurst)
+}
+
+func (c *RateLimitConfig) validate() []string {
+	problems := make([]string, 0)
+	if c.Rate > 0 && c.Burst < 1 {
+		problems = append(problems, "limits.rateLimit.burst must be positive")
+	}
+
+	if c.KeyRate > 0 && c.KeyBurst < 1 {
+		problems = append(problems, "limits.rateLimit.keyBurst must be positive")
+	}
+
+	return problems
+}
+
+// RateLimiter limits anonymous requests per IP and authenticated ones per key.
+type RateLimiter struct {
+	PerIP  *TokenBucketLimiter
+	PerKey *TokenBucketLimiter
+}
+
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		PerIP:  NewTokenBucketLimiter(config.Rate, config.Burst),
+		PerKey: NewTokenBucketLimiter(config.KeyRate, config.KeyBurst),
+	}
+}
+
+// Middleware rejects requests over the limit with a Retry-After header. Keys with the unlimited
+// scope are exempt. It expects the key to be resolved already, see OptionalAuthentication.
+func (l *RateLimiter) Middleware(next ActionHandler) ActionHandler {
+	return func(r *http.Request, body []byte) (any, error, int) {
+		var allowed bool
+		var wait time.Duration
+
+		key := RequestKey(r)
+		switch {
+		case key != nil && key.HasScope(ScopeUnlimited):
+			allowed = true
+		case key != nil:
+			allowed, wait = l.PerKey.Allow("key:"+key.Name, time.Now())
+		default:
+			allowed, wait = l.PerIP.Allow("ip:"+ClientIP(r), time.Now())
+		}
+
+		if !allowed {
+			header := make(http.Header)
+			header.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return nil, &HeaderError{Err: ErrRateLimited, Header: header}, http.StatusTooManyRequests
+		}
+
+		return next(r, body)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	useTrustedProxyHops(t, 1)
+
+	limiter := NewRateLimiter(RateLimitConfig{Rate: 0.001, Burst: 2, KeyRate: 0.001, KeyBurst: 2})
+	handler := limiter.Middleware(func(r *http.Request, body []byte) (any, error, int) {
+		return nil, nil, http.StatusOK
+	})
+
+	statuses := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		// A fresh address written by the client on every request, the proxy appends the real one
+		r := forwardedRequest("198.51.100."+strconv.Itoa(i), "203.0.113.7")
+		_, _, status := handler(r, nil)
+		statuses = append(statuses, status)
+	}
+
+	if statuses[2] != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For entries bypassed the limit, statuses %v", statuses)
+	}
+}
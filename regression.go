@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RegressionPolicy string
+
+const (
+	// RegressionAllow stores updates as they are
+	RegressionAllow RegressionPolicy = "allow"
+	// RegressionReject refuses updates that decrease stats
+	RegressionReject RegressionPolicy = "reject"
+	// RegressionPending holds updates that decrease stats for admin review
+	RegressionPending RegressionPolicy = "pending"
+	// RegressionMerge keeps the largest of stored and incoming values of monotonic stats
+	RegressionMerge RegressionPolicy = "merge"
+
+	defaultRegressionThreshold = 0.05
+	DefaultPendingPageSize     = 100
+)
+
+// nonMonotonicStats are custom stats that are reset during the game.
+var nonMonotonicStats = map[string]bool{
+	"minecraft:time_since_death": true,
+	"minecraft:time_since_rest":  true,
+}
+
+// IsMonotonicStat reports whether a stat can only grow during a season. Totals are derived
+// from other stats, so they aren't checked on their own.
+func IsMonotonicStat(groupName database.StatGroupName, key string) bool {
+	if groupName == database.StatTotals {
+		return false
+	}
+
+	return groupName != database.StatCustom || !nonMonotonicStats[key]
+}
+
+var regressionPolicies = []RegressionPolicy{RegressionAllow, RegressionReject, RegressionPending, RegressionMerge}
+
+func ParseRegressionPolicy(name string) (RegressionPolicy, error) {
+	for _, policy := range regressionPolicies {
+		if RegressionPolicy(name) == policy {
+			return policy, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown regression policy %q, expected allow, reject, pending or merge", name)
+}
+
+// RegressionConfig holds the policy of each server, Policy applies to servers without their own.
+type RegressionConfig struct {
+	Policy  RegressionPolicy            `yaml:"policy"`
+	Servers map[string]RegressionPolicy `yaml:"servers"`
+	// Threshold is the share of monotonic stats or play time that may decrease before the policy applies
+	Threshold float64 `yaml:"threshold"`
+}
+
+func DefaultRegressionConfig() RegressionConfig {
+	return RegressionConfig{
+		Policy:    RegressionAllow,
+		Servers:   make(map[string]RegressionPolicy),
+		Threshold: defaultRegressionThreshold,
+	}
+}
+
+// applyEnv overrides the policies with REGRESSION_POLICY, REGRESSION_POLICIES like
+// "survival_5=pending,creative_1=allow" and REGRESSION_THRESHOLD.
+func (c *RegressionConfig) applyEnv(env *envReader) {
+	c.Policy = RegressionPolicy(env.String("REGRESSION_POLICY", string(c.Policy)))
+	if value, ok := os.LookupEnv("REGRESSION_POLICIES"); ok {
+		c.Servers = make(map[string]RegressionPolicy)
+		for _, mapping := range splitList(value) {
+			// A mapping without a policy is kept with an empty one, so validation reports it
+			name, policy, _ := strings.Cut(mapping, "=")
+			c.Servers[strings.TrimSpace(name)] = RegressionPolicy(strings.TrimSpace(policy))
+		}
+	}
+
+	c.Threshold = env.Float("REGRESSION_THRESHOLD", c.Threshold)
+}
+
+// validate rejects unknown policies, a typo must not quietly turn a policy into allow.
+func (c *RegressionConfig) validate() []string {
+	problems := make([]string, 0)
+	if _, err := ParseRegressionPolicy(string(c.Policy)); err != nil {
+		problems = append(problems, "stats.regression.policy: "+err.Error())
+	}
+
+	servers := make([]string, 0, len(c.Servers))
+	for server := range c.Servers {
+		servers = append(servers, server)
+	}
+
+	sort.Strings(servers)
+	for _, server := range servers {
+		policy := c.Servers[server]
+		if server == "" {
+			problems = append(problems, "stats.regression.servers: server name must not be empty")
+		}
+
+		if _, err := ParseRegressionPolicy(string(policy)); err != nil {
+			problems = append(problems, fmt.Sprintf("stats.regression.servers[%s]: %s", server, err))
+		}
+	}
+
+	if c.Threshold < 0 {
+		problems = append(problems, "stats.regression.threshold must not be negative")
+	}
+
+	return problems
+}
+
+// PolicyFor returns the policy of a server.
+func (c *RegressionConfig) PolicyFor(server string) RegressionPolicy {
+	if policy, ok := c.Servers[server]; ok {
+		return policy
+	}
+
+	return c.Policy
+}
+
+type RegressionReport struct {
+	DecreasedStats int     `json:"decreasedStats"`
+	DecreasedValue float64 `json:"decreasedValue"`
+	PreviousValue  float64 `json:"previousValue"`
+	// PlayTimeDecrease is in ticks, like the play time stat itself
+	PlayTimeDecrease float64 `json:"playTimeDecrease"`
+}
+
+func playTimeOf(stats database.StatsContainer) float64 {
+	if playTime, ok := database.NumericValue(stats[database.StatCustom]["minecraft:play_time"]); ok {
+		return playTime
+	}
+
+	playTime, _ := database.NumericValue(stats[database.StatCustom]["minecraft:play_one_minute"])
+	return playTime
+}
+
+// DetectRegression compares monotonic stats and returns a report if they decreased significantly,
+// that is if play time or the sum of monotonic stats dropped by more than the threshold.
+func DetectRegression(threshold float64, previous database.StatsContainer, incoming database.StatsContainer) *RegressionReport {
+	report := &RegressionReport{}
+
+	for groupName, stats := range previous {
+		for key, value := range stats {
+			if !IsMonotonicStat(groupName, key) {
+				continue
+			}
+
+			oldValue, _ := database.NumericValue(value)
+			newValue, _ := database.NumericValue(incoming[groupName][key])
+			report.PreviousValue += oldValue
+			if newValue < oldValue {
+				report.DecreasedStats++
+				report.DecreasedValue += oldValue - newValue
+			}
+		}
+	}
+
+	previousPlayTime := playTimeOf(previous)
+	if playTime := playTimeOf(incoming); playTime < previousPlayTime {
+		report.PlayTimeDecrease = previousPlayTime - playTime
+	}
+
+	if report.DecreasedValue > threshold*report.PreviousValue || report.PlayTimeDecrease > threshold*previousPlayTime {
+		return report
+	}
+
+	return nil
+}
+
+// MergeMonotonicStats raises incoming monotonic stats to their previous values.
+func MergeMonotonicStats(previous database.StatsContainer, incoming database.StatsContainer) {
+	for groupName, stats := range previous {
+		if _, ok := incoming[groupName]; !ok {
+			incoming[groupName] = make(database.StatsMap)
+		}
+
+		for key, value := range stats {
+			if !IsMonotonicStat(groupName, key) {
+				continue
+			}
+
+			oldValue, ok := database.NumericValue(value)
+			if !ok {
+				continue
+			}
+
+			if newValue, _ := database.NumericValue(incoming[groupName][key]); newValue < oldValue {
+				incoming[groupName][key] = oldValue
+			}
+		}
+	}
+}
+
+type PendingUpdateResponse struct {
+	PendingID primitive.ObjectID `json:"pendingID"`
+	Report    *RegressionReport  `json:"regression"`
+}
+
+// ApplyRegressionPolicy handles an update that decreases stats. A zero status without an error means
+// that the update may proceed with possibly merged stats.
+func ApplyRegressionPolicy(r *http.Request, request *UpdatePlayerRequest, body []byte,
+	previous *database.StoredPlayer, report *RegressionReport) (any, int, error) {
+	server := request.Server.String()
+	policy := CurrentSettings().Regression.PolicyFor(server)
+	if policy != RegressionAllow {
+		RequestLog(r).Warn("Stats regression", "server", server, "uuid", request.UUID, "policy", policy,
+			"decreased", report.DecreasedStats, "value", report.DecreasedValue, "playTime", report.PlayTimeDecrease)
+	}
+
+	switch policy {
+	case RegressionReject:
+		DescribeChanges(RequestAuditEntry(r), previous, request.Stats)
+		return report, http.StatusConflict, nil
+	case RegressionPending:
+		DescribeChanges(RequestAuditEntry(r), previous, request.Stats)
+
+		update := &database.PendingUpdate{
+			ReceivedAt:       time.Now(),
+			PlayerUpdatedAt:  previous.UpdatedAt,
+			Server:           server,
+			UUID:             request.UUID,
+			Name:             request.Name,
+			SourceIP:         ClientIP(r),
+			DecreasedStats:   report.DecreasedStats,
+			DecreasedValue:   report.DecreasedValue,
+			PlayTimeDecrease: report.PlayTimeDecrease,
+			Body:             string(body),
+		}
+
+		if key := RequestKey(r); key != nil {
+			update.KeyName = key.Name
+		}
+
+		ctx, cancel := RequestContext(r, OperationWrite)
+		defer cancel()
+
+		id, err := database.InsertPendingUpdate(ctx, update)
+		if err != nil {
+			_, err, status := databaseError(err)
+			return nil, status, err
+		}
+
+		return &PendingUpdateResponse{PendingID: id, Report: report}, http.StatusAccepted, nil
+	case RegressionMerge:
+		MergeMonotonicStats(previous.Stats, request.Stats)
+		return nil, 0, nil
+	default:
+		return nil, 0, nil
+	}
+}
+
+type PendingUpdatesRequest struct {
+	Server ServerIdentifier `json:"server"`
+	Limit  int64            `json:"limit"`
+}
+
+func HandlePendingUpdates(r *http.Request, body []byte) (any, error, int) {
+	var request PendingUpdatesRequest
+	err := decodeRequest(r, body, &request)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	if request.Limit <= 0 {
+		request.Limit = DefaultPendingPageSize
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	updates, err := database.FindPendingUpdates(ctx, requestedServers(r, request.Server), request.Limit)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return updates, nil, http.StatusOK
+}
+
+// playerChangedSince reports whether the stored player was updated after the pending update was held back.
+func playerChangedSince(ctx context.Context, update *database.PendingUpdate) (bool, error) {
+	var player database.StoredPlayer
+	opts := options.FindOne().SetProjection(bson.D{{Key: "updatedAt", Value: 1}})
+	err := database.Database.Collection(update.Server).
+		FindOne(ctx, bson.D{{Key: "uuid", Value: update.UUID}}, opts).Decode(&player)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return !player.UpdatedAt.Equal(update.PlayerUpdatedAt), nil
+}
+
+type PendingUpdateDecision struct {
+	ID      primitive.ObjectID `json:"id"`
+	Approve bool               `json:"approve"`
+}
+
+// HandlePendingUpdateDecision applies an approved pending update or drops a rejected one.
+func HandlePendingUpdateDecision(r *http.Request, body []byte) (any, error, int) {
+	var decision PendingUpdateDecision
+	err := decodeRequest(r, body, &decision)
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationWrite)
+	defer cancel()
+
+	update, err := database.FindPendingUpdate(ctx, decision.ID)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if update == nil {
+		return nil, errors.New("pending update not found"), http.StatusNotFound
+	}
+
+	if key := RequestKey(r); key != nil && !key.AllowsServer(update.Server) {
+		return nil, errors.New("key is not allowed for server " + update.Server), http.StatusForbidden
+	}
+
+	entry := RequestAuditEntry(r)
+	entry.Server, entry.UUID, entry.Name = update.Server, update.UUID, update.Name
+
+	var output any
+	status := http.StatusNoContent
+	if decision.Approve {
+		// The held back update is a snapshot, applying it over newer updates would lose them
+		changed, err := playerChangedSince(ctx, update)
+		if err != nil {
+			return databaseError(err)
+		}
+
+		if changed {
+			return nil, errors.New("player has been updated since, the pending update can only be rejected"), http.StatusConflict
+		}
+
+		var request UpdatePlayerRequest
+		request.Stats = database.MakeStatsContainer()
+		err = json.Unmarshal([]byte(update.Body), &request)
+		if err != nil {
+			return nil, err, http.StatusInternalServerError
+		}
+
+		// Invalid stats were already quarantined when the update was received
+		ValidateStats(request.Stats, CurrentSettings().UnknownStatsPolicy)
+
+		output, err, status = UpdatePlayer(r, &request, []byte(update.Body), false)
+		if err != nil {
+			return nil, err, status
+		}
+	} else {
+		entry.Error = "pending update rejected"
+	}
+
+	err = database.DeletePendingUpdate(ctx, update.ID)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return output, nil, status
+}
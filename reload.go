@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+const defaultConfigWatchInterval = 10 * time.Second
+
+// ReloadingConfig controls how changes of the configuration file are noticed, it is only read on startup.
+type ReloadingConfig struct {
+	// WatchInterval is how often the file is checked for changes, zero only reloads on SIGHUP
+	WatchInterval time.Duration `yaml:"watchInterval"`
+}
+
+func DefaultReloadingConfig() ReloadingConfig {
+	return ReloadingConfig{WatchInterval: defaultConfigWatchInterval}
+}
+
+// applyEnv overrides the interval with CONFIG_WATCH_INTERVAL.
+func (c *ReloadingConfig) applyEnv(env *envReader) {
+	c.WatchInterval = env.Duration("CONFIG_WATCH_INTERVAL", c.WatchInterval)
+}
+
+func (c *ReloadingConfig) validate() []string {
+	problems := make([]string, 0)
+	if c.WatchInterval < 0 {
+		problems = append(problems, "reload.watchInterval must not be negative")
+	}
+
+	return problems
+}
+
+// Settings are the parts of the configuration that can change while the server is running.
+// A snapshot is never modified, reloading swaps it as a whole, so a request never sees keys
+// of one configuration with limits of another.
+type Settings struct {
+	Keys                 []*database.APIKey
+	JWTVerifier          *JWTVerifier
+	LimitExpansionKey    string
+	RequireSignedUpdates bool
+	SignatureMaxAge      time.Duration
+	AuthFailures         *AuthFailureTracker
+	CORS                 *CORSPolicy
+	RateLimiter          *RateLimiter
+	MaxRecords           int64
+	Seasons              []SeasonConfig
+	TotalRules           []TotalRule
+	StatIndexes          []StatIndexConfig
+	UnknownStatsPolicy   UnknownStatsPolicy
+	Regression           *RegressionConfig
+	Anomalies            *AnomalyConfig
+	AnomalyRules         []AnomalyRule
+
+	rateLimit RateLimitConfig
+	lockout   LockoutConfig
+}
+
+var currentSettings atomic.Value
+
+func init() {
+	config := DefaultConfig()
+	currentSettings.Store(newSettings(config, nil, nil))
+}
+
+// CurrentSettings returns the settings snapshot, handlers should read it once per request.
+func CurrentSettings() *Settings {
+	return currentSettings.Load().(*Settings)
+}
+
+// newSettings makes a snapshot of the configuration. Rate limiter buckets and failed attempts
+// are kept as long as the limits stay the same, so reloading doesn't give every client a fresh
+// burst or lift lockouts. The config is expected to be validated.
+func newSettings(config *Config, verifier *JWTVerifier, previous *Settings) *Settings {
+	cors := config.CORS
+	regression := config.Stats.Regression
+	anomalies := config.Stats.Anomalies
+	anomalyRules, _ := ParseAnomalyRules(anomalies.Rules)
+	settings := &Settings{
+		Keys:                 config.Auth.APIKeys(),
+		JWTVerifier:          verifier,
+		LimitExpansionKey:    config.Auth.LimitExpansionKey,
+		RequireSignedUpdates: config.Auth.RequireSignedUpdates,
+		SignatureMaxAge:      config.Auth.SignatureMaxAge,
+		CORS:                 &cors,
+		MaxRecords:           config.Limits.MaxRecords,
+		Seasons:              config.Seasons,
+		TotalRules:           config.Totals,
+		StatIndexes:          config.Indexes,
+		UnknownStatsPolicy:   config.Stats.UnknownKeys,
+		Regression:           &regression,
+		Anomalies:            &anomalies,
+		AnomalyRules:         anomalyRules,
+		rateLimit:            config.Limits.RateLimit,
+		lockout:              config.Auth.Lockout,
+	}
+
+	if previous != nil && previous.rateLimit == settings.rateLimit {
+		settings.RateLimiter = previous.RateLimiter
+	} else {
+		settings.RateLimiter = NewRateLimiter(settings.rateLimit)
+	}
+
+	if previous != nil && previous.lockout == settings.lockout {
+		settings.AuthFailures = previous.AuthFailures
+	} else {
+		lockout := settings.lockout
+		settings.AuthFailures = NewAuthFailureTracker(lockout.Threshold, lockout.Window, lockout.Duration)
+	}
+
+	return settings
+}
+
+// ApplyConfig swaps the settings used by handlers. Storage, HTTP and tracing settings are only read on startup.
+func ApplyConfig(config *Config) error {
+	verifier, err := config.Auth.JWT.Verifier()
+	if err != nil {
+		return fmt.Errorf("unable to configure JWT authentication: %w", err)
+	}
+
+	currentSettings.Store(newSettings(config, verifier, CurrentSettings()))
+	config.Logging.Apply()
+	return nil
+}
+
+// ReloadConfig loads and applies the configuration again. A broken configuration is logged
+// and the current one stays in use, so a typo never takes the server down.
+func ReloadConfig(path string, current *Config) *Config {
+	config, err := LoadConfig(path)
+	if err == nil {
+		err = ApplyConfig(config)
+	}
+
+	if err != nil {
+		slog.Error("Unable to reload configuration, keeping the current one", "error", err)
+		return current
+	}
+
+	if config.Storage != current.Storage || config.HTTP != current.HTTP || config.Tracing != current.Tracing ||
+		config.Reload != current.Reload {
+		slog.Warn("Storage, HTTP, tracing and reload settings have changed, they are applied on restart")
+	}
+
+	slog.Info("Configuration reloaded")
+	return config
+}
+
+func configModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// WatchConfig reloads the configuration on SIGHUP and whenever the file changes, checking it
+// every interval. A non-positive interval only reloads on SIGHUP.
+func WatchConfig(ctx context.Context, path string, config *Config, interval time.Duration) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	var ticks <-chan time.Time
+	if path != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
+	modified := configModTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			slog.Info("Received SIGHUP, reloading configuration")
+			modified = configModTime(path)
+			config = ReloadConfig(path, config)
+		case <-ticks:
+			if current := configModTime(path); !current.Equal(modified) {
+				slog.Info("Configuration file has changed, reloading", "path", path)
+				modified = current
+				config = ReloadConfig(path, config)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SeasonConfig describes a season for clients. Seasons don't have to be configured, a season
+// exists as soon as its server pushes stats.
+type SeasonConfig struct {
+	Server    string     `yaml:"server"`
+	Season    int        `yaml:"season"`
+	Title     string     `yaml:"title"`
+	StartedAt *time.Time `yaml:"startedAt"`
+	EndedAt   *time.Time `yaml:"endedAt"`
+}
+
+func (c SeasonConfig) Identifier() ServerIdentifier {
+	return ServerIdentifier{ServerName: c.Server, Season: c.Season}
+}
+
+func validateSeasons(seasons []SeasonConfig) []string {
+	problems := make([]string, 0)
+	seen := make(map[ServerIdentifier]bool)
+	for i, season := range seasons {
+		path := fmt.Sprintf("seasons[%d]", i)
+		if season.Server == "" {
+			problems = append(problems, path+".server is required")
+		}
+
+		if seen[season.Identifier()] {
+			problems = append(problems, path+": duplicate season "+season.Identifier().String())
+		}
+
+		seen[season.Identifier()] = true
+		if season.StartedAt != nil && season.EndedAt != nil && season.EndedAt.Before(*season.StartedAt) {
+			problems = append(problems, path+".endedAt is before startedAt")
+		}
+	}
+
+	return problems
+}
+
+type SeasonInfo struct {
+	Server    ServerIdentifier `json:"server"`
+	Title     string           `json:"title,omitempty"`
+	StartedAt *time.Time       `json:"startedAt,omitempty"`
+	EndedAt   *time.Time       `json:"endedAt,omitempty"`
+}
+
+// HandleSeasons lists seasons with stats along with configured ones that have none yet.
+func HandleSeasons(r *http.Request, _ []byte) (any, error, int) {
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	identifiers, err := ListSeasons(ctx)
+	if err != nil {
+		return databaseError(err)
+	}
+
+	seasons := make(map[ServerIdentifier]*SeasonInfo)
+	for _, identifier := range identifiers {
+		seasons[identifier] = &SeasonInfo{Server: identifier}
+	}
+
+	for _, season := range CurrentSettings().Seasons {
+		seasons[season.Identifier()] = &SeasonInfo{
+			Server:    season.Identifier(),
+			Title:     season.Title,
+			StartedAt: season.StartedAt,
+			EndedAt:   season.EndedAt,
+		}
+	}
+
+	result := make([]*SeasonInfo, 0, len(seasons))
+	for _, season := range seasons {
+		result = append(result, season)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Server.ServerName != result[j].Server.ServerName {
+			return result[i].Server.ServerName < result[j].Server.ServerName
+		}
+
+		return result[i].Server.Season < result[j].Server.Season
+	})
+
+	return result, nil, http.StatusOK
+}
@@ -1,58 +1,77 @@
 package main
 
 import (
-	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/bortexel/stats-server/data"
 	"github.com/bortexel/stats-server/database"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ActionHandler func(r *http.Request, input []byte) (output any, err error, status int)
 
 func MainHandler(w http.ResponseWriter, r *http.Request) {
-	EnableCORS(w)
-	var next ActionHandler
+	if CurrentSettings().CORS.Apply(w, r) {
+		return
+	}
 
-	switch r.Method {
-	case http.MethodOptions: // CORS
-		next = HandleRoot
-	case http.MethodGet: // Root (health checks, etc.)
-		next = HandleRoot
-	case http.MethodPost: // Request leaderboard
-		next = HandlePlayerInfo
-	case http.MethodPatch: // Update player info
-		next = ConfiguredAuthorizationMiddleware(HandleUpdatePlayer)
-	default:
+	r, info := withRequestInfo(r)
+	w.Header().Set(RequestIDHeader, info.ID)
+
+	startedAt := time.Now()
+	action, next := Route(r)
+	if next == nil {
 		w.WriteHeader(http.StatusMethodNotAllowed)
+		logAccess(r, action, http.StatusMethodNotAllowed, time.Since(startedAt), nil)
 		return
 	}
 
+	r, span := StartRequestSpan(r, action)
+	status, err := serveAction(w, r, next)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= 500 {
+		EndSpan(span, err)
+	} else {
+		span.End()
+	}
+
+	duration := time.Since(startedAt)
+	ObserveRequest(action, status, duration)
+	logAccess(r, action, status, duration, err)
+}
+
+// serveAction runs an action and writes its response, it returns the response status and the error of the action.
+func serveAction(w http.ResponseWriter, r *http.Request, next ActionHandler) (int, error) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		return
+		return http.StatusBadRequest, err
 	}
 
 	responseData, err, status := next(r, body)
 	if err != nil {
-		w.WriteHeader(status)
-
-		if status >= 500 {
-			log.Println("Error serving", r.Method, "request:", err)
+		var headerError *HeaderError
+		if errors.As(err, &headerError) {
+			for name, values := range headerError.Header {
+				w.Header()[name] = values
+			}
 		}
 
-		return
+		w.WriteHeader(status)
+		return status, err
 	}
 
 	if responseData != nil {
@@ -60,15 +79,86 @@ func MainHandler(w http.ResponseWriter, r *http.Request) {
 	} else {
 		w.WriteHeader(status)
 	}
+
+	return status, nil
 }
 
-func HandleRoot(_ *http.Request, _ []byte) (any, error, int) {
-	return nil, nil, http.StatusNoContent
+// PublicRead wraps actions that anyone may call, resolving optional credentials before rate limiting.
+func PublicRead(next ActionHandler) ActionHandler {
+	return OptionalAuthentication(CurrentSettings().RateLimiter.Middleware(next))
+}
+
+// HeaderError is an error that needs extra response headers, like Retry-After.
+type HeaderError struct {
+	Err    error
+	Header http.Header
 }
 
-func EnableCORS(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST")
+func (e *HeaderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+// Route picks the action for a request along with its name used in metrics. Dedicated endpoints
+// are matched by path, everything else falls back to the method-based actions served on any path.
+func Route(r *http.Request) (string, ActionHandler) {
+	if r.Method == http.MethodPost {
+		switch r.URL.Path {
+		case "/profile": // Cross-season player profile
+			return "profile", PublicRead(HandlePlayerProfile)
+		case "/leaderboard/all-time": // Leaderboard summed across seasons
+			return "leaderboard_all_time", PublicRead(HandleAllTimeLeaderboard)
+		case "/compare": // Player-vs-player comparison
+			return "compare", PublicRead(HandleComparePlayers)
+		case "/server/stats": // Server-wide aggregated statistics
+			return "server_stats", PublicRead(HandleServerStatistics)
+		case "/distribution": // Percentiles and histograms of a stat
+			return "distribution", PublicRead(HandleDistribution)
+		case "/audit": // Audit log of player updates
+			return "audit", Authorization(ScopeAdmin)(HandleAuditLog)
+		case "/pending": // Updates held back by the regression guard
+			return "pending", Authorization(ScopeAdmin)(HandlePendingUpdates)
+		case "/pending/decide": // Approve or reject a held back update
+			return "pending_decide", Authorization(ScopeAdmin)(AuditUpdates(HandlePendingUpdateDecision))
+		case "/moderation/flags": // Players flagged for suspicious stat jumps
+			return "moderation_flags", Authorization(ScopeAdmin)(HandleAnomalyFlags)
+		case "/moderation/flags/review": // Mark a flag as reviewed
+			return "moderation_flags_review", Authorization(ScopeAdmin)(HandleReviewAnomalyFlag)
+		case "/logging/level": // Change the log level until the configuration is reloaded
+			return "logging_level", Authorization(ScopeAdmin)(HandleLogLevel)
+		}
+	}
+
+	if r.Method == http.MethodGet {
+		switch r.URL.Path {
+		case "/health/live": // Liveness probe
+			return "health_live", HandleLiveness
+		case "/health/ready": // Readiness probe, checks dependencies
+			return "health_ready", HandleReadiness
+		case "/seasons": // Known seasons with their metadata
+			return "seasons", PublicRead(HandleSeasons)
+		}
+	}
+
+	switch r.Method {
+	case http.MethodOptions: // Preflights are answered by the CORS policy, plain OPTIONS are no-ops
+		return "options", HandleRoot
+	case http.MethodGet: // Root (health checks, etc.)
+		return "root", HandleRoot
+	case http.MethodPost: // Request leaderboard
+		return "leaderboard", PublicRead(HandlePlayerInfo)
+	case http.MethodPatch: // Update player info
+		return "update", ConfiguredAuthorizationMiddleware(AuditUpdates(HandleUpdatePlayer))
+	default:
+		return "", nil
+	}
+}
+
+func HandleRoot(_ *http.Request, _ []byte) (any, error, int) {
+	return nil, nil, http.StatusNoContent
 }
 
 type SortDirection string
@@ -99,6 +189,10 @@ func (o SortOptions) GetDirection() SortDirection {
 	return SortDirectionDescending
 }
 
+func (o SortOptions) IsValid() bool {
+	return o.Field.FieldName != "" && o.Field.GroupName != ""
+}
+
 type ServerIdentifier struct {
 	ServerName string `json:"serverName"`
 	Season     int    `json:"season"`
@@ -108,8 +202,62 @@ func (i ServerIdentifier) String() string {
 	return fmt.Sprintf("%s_%d", i.ServerName, i.Season)
 }
 
+// ParseServerIdentifier is the reverse of ServerIdentifier.String, it reports false
+// for collection names that don't belong to a season.
+func ParseServerIdentifier(collectionName string) (ServerIdentifier, bool) {
+	separator := strings.LastIndex(collectionName, "_")
+	if separator <= 0 {
+		return ServerIdentifier{}, false
+	}
+
+	season, err := strconv.Atoi(collectionName[separator+1:])
+	if err != nil {
+		return ServerIdentifier{}, false
+	}
+
+	return ServerIdentifier{ServerName: collectionName[:separator], Season: season}, true
+}
+
 func (r LeaderboardRequest) ShouldSort() bool {
-	return r.Sort.Field.FieldName != "" && r.Sort.Field.GroupName != ""
+	return r.Sort.IsValid()
+}
+
+const MaxSortFields = 5
+
+// getSortOptions returns the ordered list of sort fields, falling back to the single
+// legacy sort field for clients that don't send the list.
+func (r LeaderboardRequest) getSortOptions() []SortOptions {
+	if len(r.Sorts) == 0 && r.ShouldSort() {
+		return []SortOptions{r.Sort}
+	}
+
+	return r.Sorts
+}
+
+func (r LeaderboardRequest) makeSort() (bson.D, error) {
+	sortOptions := r.getSortOptions()
+	if len(sortOptions) > MaxSortFields {
+		return nil, errors.New("too many sort fields")
+	}
+
+	sort := bson.D{}
+	seen := make(map[string]bool)
+	for _, option := range sortOptions {
+		if !option.IsValid() {
+			return nil, errors.New("sort field group and name are required")
+		}
+
+		path := option.Field.GetFullPath()
+		if seen[path] {
+			continue
+		}
+
+		seen[path] = true
+		sort = append(sort, bson.E{Key: path, Value: option.GetDirection().getValue()})
+	}
+
+	// UUIDs are unique, so the final tie-breaker keeps the order stable between requests and pages
+	return append(sort, bson.E{Key: "uuid", Value: 1}), nil
 }
 
 type StatField struct {
@@ -120,7 +268,7 @@ type StatField struct {
 func (f *StatField) RemoveSpecialCharacters() {
 	f.GroupName = strings.ReplaceAll(f.GroupName, ".", "")
 	f.GroupName = strings.ReplaceAll(f.GroupName, "$", "")
-	f.FieldName = strings.ReplaceAll(f.FieldName, "$", "")
+	f.FieldName = strings.ReplaceAll(f.FieldName, ".", "")
 	f.FieldName = strings.ReplaceAll(f.FieldName, "$", "")
 }
 
@@ -131,6 +279,9 @@ func (f *StatField) GetFullPath() string {
 
 type LeaderboardRequest struct {
 	Sort               SortOptions      `json:"sort"`
+	Sorts              []SortOptions    `json:"sorts"`
+	Offset             int64            `json:"offset"`
+	Where              LeaderboardWhere `json:"where"`
 	Server             ServerIdentifier `json:"server"`
 	PlayerUUID         string           `json:"playerUUID"`
 	PlayerName         string           `json:"playerName"`
@@ -139,14 +290,26 @@ type LeaderboardRequest struct {
 	LimitExpansionKey  string           `json:"limitExpansionKey"`
 }
 
-const MaxRecords int64 = 100
+const defaultMaxRecords int64 = 100
+
+func (r LeaderboardRequest) getRecordLimit(httpRequest *http.Request) int64 {
+	return getRecordLimit(httpRequest, r.Server.String(), r.LimitExpansionKey)
+}
+
+// getRecordLimit lifts the limit for requests authenticated with the limit expansion scope for the server.
+// The limit expansion key in the body is deprecated and only honored while one is configured.
+func getRecordLimit(r *http.Request, server string, limitExpansionKey string) int64 {
+	settings := CurrentSettings()
+	if settings.LimitExpansionKey != "" &&
+		subtle.ConstantTimeCompare([]byte(settings.LimitExpansionKey), []byte(limitExpansionKey)) == 1 {
+		return 0
+	}
 
-func (r LeaderboardRequest) getRecordLimit() int64 {
-	if expectedKey, ok := os.LookupEnv("LIMIT_EXPANSION_KEY"); ok && expectedKey == r.LimitExpansionKey {
+	if key := RequestKey(r); key != nil && key.HasScope(ScopeLimitExpansion) && key.AllowsServer(server) {
 		return 0
 	}
 
-	return MaxRecords
+	return settings.MaxRecords
 }
 
 func (r LeaderboardRequest) makeProjection() bson.D {
@@ -163,50 +326,70 @@ func (r LeaderboardRequest) makeProjection() bson.D {
 	return projection
 }
 
-func (r LeaderboardRequest) makeFilter() bson.D {
-	filter := bson.D{}
+func (r LeaderboardRequest) makeFilter() (bson.D, error) {
+	conditions := make([]bson.D, 0)
 
 	if r.PlayerUUID != "" {
-		filter = append(filter, bson.E{Key: "uuid", Value: r.PlayerUUID})
+		conditions = append(conditions, bson.D{{Key: "uuid", Value: r.PlayerUUID}})
 	}
 
 	if r.PlayerName != "" {
-		filter = append(filter, bson.E{Key: "name", Value: r.PlayerName})
+		conditions = append(conditions, bson.D{{Key: "name", Value: r.PlayerName}})
 	}
 
-	return filter
+	extraConditions, err := r.Where.makeConditions()
+	if err != nil {
+		return nil, err
+	}
+
+	return combineConditions(append(conditions, extraConditions...)), nil
 }
 
-func HandlePlayerInfo(_ *http.Request, body []byte) (any, error, int) {
+func HandlePlayerInfo(r *http.Request, body []byte) (any, error, int) {
 	var request LeaderboardRequest
-	err := json.Unmarshal(body, &request)
+	err := decodeRequest(r, body, &request)
 	if err != nil {
 		return nil, err, http.StatusUnprocessableEntity
 	}
 
-	opts := options.Find()
-	if request.ShouldSort() {
-		opts.SetSort(bson.D{{request.Sort.Field.GetFullPath(), request.Sort.GetDirection().getValue()}})
+	if request.Offset < 0 {
+		return nil, errors.New("offset must not be negative"), http.StatusUnprocessableEntity
 	}
 
+	sort, err := request.makeSort()
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	opts := options.Find()
+	opts.SetSort(sort)
+	opts.SetSkip(request.Offset)
 	opts.SetProjection(request.makeProjection())
-	opts.SetLimit(request.getRecordLimit())
+	opts.SetLimit(request.getRecordLimit(r))
+
+	filter, err := request.makeFilter()
+	if err != nil {
+		return nil, err, http.StatusUnprocessableEntity
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
 
 	cursor, err := database.Database.Collection(request.Server.String()).
-		Find(context.Background(), request.makeFilter(), opts)
+		Find(ctx, filter, opts)
 	if err != nil {
-		return nil, err, http.StatusInternalServerError
+		return databaseError(err)
 	}
 
 	var results []*database.StoredPlayer
-	err = cursor.All(context.Background(), &results)
+	err = cursor.All(ctx, &results)
 
 	if err == mongo.ErrNoDocuments || results == nil || len(results) == 0 {
 		return nil, nil, http.StatusNotFound
 	}
 
 	if err != nil {
-		return nil, err, http.StatusInternalServerError
+		return databaseError(err)
 	}
 
 	return results, nil, http.StatusOK
@@ -225,79 +408,116 @@ type AdvancementInput struct {
 	Done bool   `json:"done"`
 }
 
-func HandleUpdatePlayer(_ *http.Request, body []byte) (any, error, int) {
+func HandleUpdatePlayer(r *http.Request, body []byte) (any, error, int) {
 	var request UpdatePlayerRequest
 	request.Stats = database.MakeStatsContainer()
-	err := json.Unmarshal(body, &request)
+	err := decodeRequest(r, body, &request)
 	if err != nil {
 		return nil, err, http.StatusUnprocessableEntity
 	}
 
+	// Authorization only checks the server when there is one
+	if request.Server.ServerName == "" {
+		return nil, errors.New("server is required"), http.StatusUnprocessableEntity
+	}
+
+	policy := CurrentSettings().UnknownStatsPolicy
+	validation := ValidateStats(request.Stats, policy)
+	if !validation.IsValid() {
+		if policy == UnknownStatsReject {
+			RequestAuditEntry(r).Error = validation.Error()
+			return validation.truncate(), nil, http.StatusUnprocessableEntity
+		}
+
+		QuarantineStats(r, &request, validation)
+	}
+
+	return UpdatePlayer(r, &request, body, true)
+}
+
+// UpdatePlayer stores an update request, guard applies the regression policy of the server
+// and is only disabled for updates that have already been reviewed.
+func UpdatePlayer(r *http.Request, request *UpdatePlayerRequest, body []byte, guard bool) (any, error, int) {
 	stats := request.Stats
 	advancements := FormatAdvancements(request.Advancements)
-	AppendTotalStats(stats, len(advancements))
+
+	ctx, cancel := RequestContext(r, OperationWrite)
+	defer cancel()
 
 	var player database.StoredPlayer
+	collection := database.Database.Collection(request.Server.String())
+	err := collection.FindOne(ctx, bson.D{{Key: "uuid", Value: request.UUID}}).Decode(&player)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return databaseError(err)
+	}
+
+	exists := err == nil
+	if exists && guard {
+		if report := DetectRegression(CurrentSettings().Regression.Threshold, player.Stats, stats); report != nil {
+			output, status, err := ApplyRegressionPolicy(r, request, body, &player, report)
+			if status != 0 || err != nil {
+				return output, err, status
+			}
+		}
+	}
+
+	_, span := StartSpan(ctx, "totals.compute", trace.SpanKindInternal, attribute.Int("rules", len(CurrentSettings().TotalRules)))
+	AppendTotalStats(stats, len(advancements))
+	span.End()
+
+	if exists {
+		FlagAnomalies(r, request, player.Stats)
+	}
+
 	newPlayer := database.Player{
 		UUID:         request.UUID,
 		Name:         request.Name,
 		Stats:        stats,
 		Advancements: advancements,
+		// Mongo keeps milliseconds, pending updates compare it with the stored value
+		UpdatedAt: time.Now().UTC().Truncate(time.Millisecond),
 	}
 
-	collection := database.Database.Collection(request.Server.String())
-	err = collection.FindOne(context.Background(), bson.D{{"uuid", request.UUID}}).Decode(&player)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			// Create a new player
-			result, err := collection.InsertOne(context.Background(), newPlayer)
-			if err != nil {
-				return nil, err, http.StatusInternalServerError
-			}
-
-			err = collection.FindOne(context.Background(), bson.D{{"_id", result.InsertedID}}).Decode(&player)
-			if err != nil {
-				return nil, err, http.StatusInternalServerError
-			}
+	if !exists {
+		DescribeChanges(RequestAuditEntry(r), nil, stats)
+		prepareSeason(ctx, r, request.Server)
 
-			return player, nil, http.StatusOK
-		} else {
-			return nil, err, http.StatusInternalServerError
-		}
-	} else {
-		_, err := collection.UpdateOne(context.Background(), bson.D{{"uuid", request.UUID}}, bson.M{"$set": newPlayer})
+		// Create a new player
+		result, err := collection.InsertOne(ctx, newPlayer)
 		if err != nil {
-			return nil, err, http.StatusInternalServerError
+			return databaseError(err)
 		}
 
-		err = collection.FindOne(context.Background(), bson.D{{"uuid", request.UUID}}).Decode(&player)
+		err = collection.FindOne(ctx, bson.D{{Key: "_id", Value: result.InsertedID}}).Decode(&player)
 		if err != nil {
-			return nil, err, http.StatusInternalServerError
+			return databaseError(err)
 		}
 
 		return player, nil, http.StatusOK
 	}
-}
 
-func AppendTotalStats(stats database.StatsContainer, advancementsCount int) {
-	var deaths int64
-	var playTime int64
+	DescribeChanges(RequestAuditEntry(r), &player, stats)
 
-	if actualDeaths, ok := stats[database.StatCustom]["minecraft:deaths"]; ok {
-		deaths = int64(actualDeaths.(float64))
+	_, err = collection.UpdateOne(ctx, bson.D{{Key: "uuid", Value: request.UUID}}, bson.M{"$set": newPlayer})
+	if err != nil {
+		return databaseError(err)
+	}
+
+	player = database.StoredPlayer{}
+	err = collection.FindOne(ctx, bson.D{{Key: "uuid", Value: request.UUID}}).Decode(&player)
+	if err != nil {
+		return databaseError(err)
 	}
 
-	if actualPlayTime, ok := stats[database.StatCustom]["minecraft:play_time"]; ok {
-		playTime = int64(actualPlayTime.(float64) / 20)
-	} else if actualPlayTime, ok := stats[database.StatCustom]["minecraft:play_one_minute"]; ok {
-		playTime = int64(actualPlayTime.(float64) / 20)
+	return player, nil, http.StatusOK
+}
+
+func AppendTotalStats(stats database.StatsContainer, advancementsCount int) {
+	for _, rule := range CurrentSettings().TotalRules {
+		stats[database.StatTotals][rule.Key] = rule.Compute(stats)
 	}
 
-	stats[database.StatTotals]["bortexel:deaths"] = deaths
-	stats[database.StatTotals]["bortexel:play_time"] = playTime
-	stats[database.StatTotals]["bortexel:blocks_placed"] = stats[database.StatUsed].GetValueSum(data.IsBlock)
-	stats[database.StatTotals]["bortexel:blocks_broken"] = stats[database.StatMined].GetValueSum(database.EmptyPredicate)
-	stats[database.StatTotals]["bortexel:advancements_done"] = advancementsCount
+	stats[database.StatTotals][advancementsDoneTotal] = advancementsCount
 }
 
 func FormatAdvancements(inputAdvancements []*AdvancementInput) []*database.Advancement {
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+const (
+	SignatureScheme          = "Ed25519 "
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+
+	defaultSignatureMaxAge = 5 * time.Minute
+	maxNonceLength         = 64
+)
+
+// NonceCache remembers nonces of accepted signatures until they are too old to be replayed anyway.
+type NonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewNonceCache() *NonceCache {
+	return &NonceCache{seen: make(map[string]time.Time)}
+}
+
+// Use records a nonce and reports false if it has already been used. The max age is passed
+// along with every nonce, so reloading the configuration keeps the nonces seen so far.
+func (c *NonceCache) Use(keyName string, nonce string, maxAge time.Duration, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for seenNonce, seenAt := range c.seen {
+		if now.Sub(seenAt) > 2*maxAge {
+			delete(c.seen, seenNonce)
+		}
+	}
+
+	id := keyName + ":" + nonce
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+
+	c.seen[id] = now
+	return true
+}
+
+var UsedNonces = NewNonceCache()
+
+func IsSignedRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), SignatureScheme)
+}
+
+// SignaturePayload is the message clients sign: method, path, timestamp, nonce and body separated by newlines.
+func SignaturePayload(r *http.Request, timestamp string, nonce string, body []byte) []byte {
+	payload := strings.Join([]string{r.Method, r.URL.Path, timestamp, nonce, ""}, "\n")
+	return append([]byte(payload), body...)
+}
+
+// Sign computes the hex-encoded Ed25519 signature of a payload. Clients keep the private key,
+// the server only stores the public one, so nothing it stores is enough to sign requests.
+func Sign(privateKey ed25519.PrivateKey, payload []byte) string {
+	return hex.EncodeToString(ed25519.Sign(privateKey, payload))
+}
+
+// VerifySignature checks a hex-encoded signature of a payload against a hex-encoded public key.
+func VerifySignature(publicKey string, payload []byte, signature string) bool {
+	decodedKey, err := hex.DecodeString(publicKey)
+	if err != nil || len(decodedKey) != ed25519.PublicKeySize {
+		return false
+	}
+
+	decodedSignature, err := hex.DecodeString(signature)
+	if err != nil || len(decodedSignature) != ed25519.SignatureSize {
+		return false
+	}
+
+	return ed25519.Verify(decodedKey, payload, decodedSignature)
+}
+
+// AuthenticateSignature resolves the key of a request with the header
+// "Authorization: Ed25519 <key name>:<signature>" and rejects stale or replayed signatures.
+// Only keys with a public key can sign requests.
+func AuthenticateSignature(r *http.Request, body []byte) (*database.APIKey, error) {
+	credentials := strings.TrimPrefix(r.Header.Get("Authorization"), SignatureScheme)
+	separator := strings.LastIndex(credentials, ":")
+	if separator <= 0 {
+		return nil, ErrUnauthorized
+	}
+
+	keyName, signature := credentials[:separator], credentials[separator+1:]
+	timestamp := r.Header.Get(SignatureTimestampHeader)
+	nonce := r.Header.Get(SignatureNonceHeader)
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return nil, ErrUnauthorized
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrUnauthorized
+	}
+
+	now := time.Now()
+	maxAge := CurrentSettings().SignatureMaxAge
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > maxAge || age < -maxAge {
+		return nil, ErrUnauthorized
+	}
+
+	ctx, cancel := RequestContext(r, OperationRead)
+	defer cancel()
+
+	key, err := LookupKeyByName(ctx, keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil || key.PublicKey == "" {
+		return nil, ErrUnauthorized
+	}
+
+	if !VerifySignature(key.PublicKey, SignaturePayload(r, timestamp, nonce, body), signature) {
+		return nil, ErrUnauthorized
+	}
+
+	// Only valid signatures take up nonces, otherwise anyone could burn them
+	if !UsedNonces.Use(key.Name, nonce, maxAge, now) {
+		return nil, ErrUnauthorized
+	}
+
+	return key, nil
+}
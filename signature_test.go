@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bortexel/stats-server/database"
+)
+
+// useSigningKey makes a key with a fresh key pair the only configured key.
+func useSigningKey(t *testing.T) (*database.APIKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &database.APIKey{Name: "survival-plugin", PublicKey: hex.EncodeToString(publicKey), Servers: []string{"*"}}
+	previous := CurrentSettings()
+	settings := *previous
+	settings.Keys = []*database.APIKey{key}
+	currentSettings.Store(&settings)
+	t.Cleanup(func() { currentSettings.Store(previous) })
+
+	return key, privateKey
+}
+
+func signedRequest(privateKey ed25519.PrivateKey, keyName string, timestamp time.Time, nonce string, body []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/update", bytes.NewReader(body))
+	seconds := strconv.FormatInt(timestamp.Unix(), 10)
+	signature := Sign(privateKey, SignaturePayload(r, seconds, nonce, body))
+
+	r.Header.Set("Authorization", SignatureScheme+keyName+":"+signature)
+	r.Header.Set(SignatureTimestampHeader, seconds)
+	r.Header.Set(SignatureNonceHeader, nonce)
+	return r
+}
+
+func TestSignaturePayload(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/update?ignored=1", nil)
+	payload := SignaturePayload(r, "1700000000", "abc", []byte(`{"uuid":"1"}`))
+
+	expected := "POST\n/update\n1700000000\nabc\n{\"uuid\":\"1\"}"
+	if string(payload) != expected {
+		t.Fatalf("unexpected payload %q", payload)
+	}
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	key, privateKey := useSigningKey(t)
+	body := []byte(`{"server":{"serverName":"survival","season":5}}`)
+
+	r := signedRequest(privateKey, key.Name, time.Now(), "valid", body)
+	authenticated, err := AuthenticateSignature(r, body)
+	if err != nil || authenticated != key {
+		t.Fatalf("expected the key, got %v, %v", authenticated, err)
+	}
+}
+
+func TestAuthenticateSignatureRejectsTamperedBody(t *testing.T) {
+	key, privateKey := useSigningKey(t)
+	body := []byte(`{"stats":{"minecraft:custom":{"minecraft:deaths":1}}}`)
+
+	r := signedRequest(privateKey, key.Name, time.Now(), "tampered", body)
+	tampered := []byte(`{"stats":{"minecraft:custom":{"minecraft:deaths":0}}}`)
+	if _, err := AuthenticateSignature(r, tampered); err != ErrUnauthorized {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestAuthenticateSignatureRejectsSkew(t *testing.T) {
+	key, privateKey := useSigningKey(t)
+	body := []byte(`{}`)
+
+	for _, skew := range []time.Duration{-defaultSignatureMaxAge - time.Minute, defaultSignatureMaxAge + time.Minute} {
+		r := signedRequest(privateKey, key.Name, time.Now().Add(skew), "skew"+skew.String(), body)
+		if _, err := AuthenticateSignature(r, body); err != ErrUnauthorized {
+			t.Fatalf("expected ErrUnauthorized for skew %s, got %v", skew, err)
+		}
+	}
+}
+
+func TestAuthenticateSignatureRejectsReplay(t *testing.T) {
+	key, privateKey := useSigningKey(t)
+	body := []byte(`{}`)
+
+	r := signedRequest(privateKey, key.Name, time.Now(), "replayed", body)
+	if _, err := AuthenticateSignature(r, body); err != nil {
+		t.Fatalf("expected the first request to pass, got %v", err)
+	}
+
+	if _, err := AuthenticateSignature(r, body); err != ErrUnauthorized {
+		t.Fatalf("expected ErrUnauthorized for the replay, got %v", err)
+	}
+}
+
+func TestAuthenticateSignatureRejectsOtherKeys(t *testing.T) {
+	key, _ := useSigningKey(t)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	body := []byte(`{}`)
+
+	r := signedRequest(otherKey, key.Name, time.Now(), "other", body)
+	if _, err := AuthenticateSignature(r, body); err != ErrUnauthorized {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StatusClientClosedRequest is reported when the client went away before the response was ready.
+const StatusClientClosedRequest = 499
+
+type OperationKind int
+
+const (
+	OperationRead OperationKind = iota
+	OperationWrite
+	OperationAggregate
+)
+
+const (
+	defaultReadOperationTimeout      = 5 * time.Second
+	defaultWriteOperationTimeout     = 10 * time.Second
+	defaultAggregateOperationTimeout = 30 * time.Second
+)
+
+// OperationTimeouts are deadlines of database operations by kind. They are only read on startup.
+type OperationTimeouts struct {
+	Read      time.Duration `yaml:"read"`
+	Write     time.Duration `yaml:"write"`
+	Aggregate time.Duration `yaml:"aggregate"`
+}
+
+func DefaultOperationTimeouts() OperationTimeouts {
+	return OperationTimeouts{
+		Read:      defaultReadOperationTimeout,
+		Write:     defaultWriteOperationTimeout,
+		Aggregate: defaultAggregateOperationTimeout,
+	}
+}
+
+// applyEnv overrides the timeouts with DB_*_TIMEOUT variables.
+func (t *OperationTimeouts) applyEnv(env *envReader) {
+	t.Read = env.Duration("DB_READ_TIMEOUT", t.Read)
+	t.Write = env.Duration("DB_WRITE_TIMEOUT", t.Write)
+	t.Aggregate = env.Duration("DB_AGGREGATE_TIMEOUT", t.Aggregate)
+}
+
+func (t *OperationTimeouts) validate() []string {
+	problems := make([]string, 0)
+	if t.Read <= 0 || t.Write <= 0 || t.Aggregate <= 0 {
+		problems = append(problems, "storage.timeouts must be positive")
+	}
+
+	return problems
+}
+
+// Longest returns the largest of the timeouts, requests may wait that long for the database.
+func (t OperationTimeouts) Longest() time.Duration {
+	return max(t.Read, t.Write, t.Aggregate)
+}
+
+// Apply sets the deadlines used by operation contexts, the timeouts are expected to be validated.
+func (t OperationTimeouts) Apply() {
+	operationTimeouts = map[OperationKind]time.Duration{
+		OperationRead:      t.Read,
+		OperationWrite:     t.Write,
+		OperationAggregate: t.Aggregate,
+	}
+}
+
+var operationTimeouts = map[OperationKind]time.Duration{
+	OperationRead:      defaultReadOperationTimeout,
+	OperationWrite:     defaultWriteOperationTimeout,
+	OperationAggregate: defaultAggregateOperationTimeout,
+}
+
+// OperationContext limits database operations of a kind with the configured deadline.
+func OperationContext(parent context.Context, kind OperationKind) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, operationTimeouts[kind])
+}
+
+// RequestContext is an operation context that is also cancelled when the client disconnects.
+func RequestContext(r *http.Request, kind OperationKind) (context.Context, context.CancelFunc) {
+	return OperationContext(r.Context(), kind)
+}
+
+// BackgroundContext is an operation context for bookkeeping, like audit entries, that has to
+// be finished even if the client disconnects.
+func BackgroundContext(kind OperationKind) (context.Context, context.CancelFunc) {
+	return OperationContext(context.Background(), kind)
+}
+
+// databaseError picks the status for a failed database operation: 504 if it ran out of time.
+func databaseError(err error) (any, error, int) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil, err, StatusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err):
+		return nil, err, http.StatusGatewayTimeout
+	default:
+		return nil, err, http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bortexel/stats-server/data"
+	"github.com/bortexel/stats-server/database"
+)
+
+const advancementsDoneTotal = "bortexel:advancements_done"
+
+// TotalRule derives a stat of the totals group from another group. The listed stats are summed,
+// or every stat of the group if none are listed, and the sum is divided by the divisor.
+type TotalRule struct {
+	Key   string                 `yaml:"key"`
+	Group database.StatGroupName `yaml:"group"`
+	// Stats are summed unless FirstOf is set
+	Stats []string `yaml:"stats"`
+	// FirstOf takes the first listed stat that is present instead of the sum, like the new
+	// name of a renamed stat before the old one, so a player having both isn't counted twice
+	FirstOf bool `yaml:"firstOf"`
+	// BlocksOnly skips stats that aren't blocks, like used items
+	BlocksOnly bool `yaml:"blocksOnly"`
+	// Divisor converts units, like ticks to seconds, zero means no conversion
+	Divisor float64 `yaml:"divisor"`
+}
+
+func DefaultTotalRules() []TotalRule {
+	return []TotalRule{
+		{Key: "bortexel:deaths", Group: database.StatCustom, Stats: []string{"minecraft:deaths"}},
+		{Key: "bortexel:play_time", Group: database.StatCustom, Stats: []string{"minecraft:play_time", "minecraft:play_one_minute"}, FirstOf: true, Divisor: 20},
+		{Key: "bortexel:blocks_placed", Group: database.StatUsed, BlocksOnly: true},
+		{Key: "bortexel:blocks_broken", Group: database.StatMined},
+	}
+}
+
+func (r TotalRule) includes(key string) bool {
+	if r.BlocksOnly && !data.IsBlock(key) {
+		return false
+	}
+
+	if len(r.Stats) == 0 {
+		return true
+	}
+
+	for _, stat := range r.Stats {
+		if stat == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// firstOf returns the value of the first listed stat that is present.
+func (r TotalRule) firstOf(stats database.StatsMap) float64 {
+	for _, key := range r.Stats {
+		if value, ok := database.NumericValue(stats[key]); ok && r.includes(key) {
+			return value
+		}
+	}
+
+	return 0
+}
+
+func (r TotalRule) Compute(stats database.StatsContainer) int64 {
+	var sum float64
+	if r.FirstOf {
+		sum = r.firstOf(stats[r.Group])
+	} else {
+		for key, value := range stats[r.Group] {
+			if !r.includes(key) {
+				continue
+			}
+
+			number, _ := database.NumericValue(value)
+			sum += number
+		}
+	}
+
+	if r.Divisor > 0 {
+		sum /= r.Divisor
+	}
+
+	return int64(sum)
+}
+
+func validateTotalRules(rules []TotalRule) []string {
+	problems := make([]string, 0)
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		path := fmt.Sprintf("totals[%d]", i)
+		switch {
+		case rule.Key == "":
+			problems = append(problems, path+".key is required")
+		case rule.Key == advancementsDoneTotal:
+			problems = append(problems, path+": "+advancementsDoneTotal+" is computed from advancements")
+		case seen[rule.Key]:
+			problems = append(problems, path+": duplicate key "+rule.Key)
+		}
+
+		seen[rule.Key] = true
+		if !database.IsKnownStatGroup(rule.Group) || rule.Group == database.StatTotals {
+			problems = append(problems, fmt.Sprintf("%s: unknown group %q", path, rule.Group))
+		}
+
+		if rule.FirstOf && len(rule.Stats) == 0 {
+			problems = append(problems, path+".stats are required with firstOf")
+		}
+
+		if rule.Divisor < 0 {
+			problems = append(problems, path+".divisor must not be negative")
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultTracingServiceName = "stats-server"
+	tracingExportTimeout      = 10 * time.Second
+	tracingScopeName          = "github.com/bortexel/stats-server"
+)
+
+// TracingConfig enables tracing when the endpoint of an OTLP/HTTP collector is set,
+// like http://localhost:4318. It is only read on startup.
+type TracingConfig struct {
+	Endpoint    string `yaml:"endpoint"`
+	ServiceName string `yaml:"serviceName"`
+	// SampleRatio is the share of requests that are recorded. Traces are continued from
+	// traceparent headers, but the sampled flag of callers is ignored, anyone can set it.
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+func DefaultTracingConfig() TracingConfig {
+	return TracingConfig{ServiceName: defaultTracingServiceName, SampleRatio: 1}
+}
+
+// applyEnv overrides the settings with the standard OpenTelemetry variables.
+func (c *TracingConfig) applyEnv(env *envReader) {
+	c.Endpoint = env.String("OTEL_EXPORTER_OTLP_ENDPOINT", c.Endpoint)
+	c.ServiceName = env.String("OTEL_SERVICE_NAME", c.ServiceName)
+	c.SampleRatio = env.Float("OTEL_TRACES_SAMPLER_ARG", c.SampleRatio)
+}
+
+func (c *TracingConfig) validate() []string {
+	problems := make([]string, 0)
+	if c.Endpoint != "" && !strings.HasPrefix(c.Endpoint, "http://") && !strings.HasPrefix(c.Endpoint, "https://") {
+		problems = append(problems, "tracing.endpoint must be an http or https URL")
+	}
+
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		problems = append(problems, "tracing.sampleRatio must be between 0 and 1")
+	}
+
+	return problems
+}
+
+// traceContext reads the W3C traceparent header of callers.
+var traceContext = propagation.TraceContext{}
+
+// NewTracerProvider batches spans and exports them to the OTLP/HTTP collector of the config.
+// The caller installs it with otel.SetTracerProvider and shuts it down to flush the last spans.
+func NewTracerProvider(ctx context.Context, config TracingConfig) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(config.Endpoint, "/")+"/v1/traces"),
+		otlptracehttp.WithTimeout(tracingExportTimeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tracing must never fail requests, export errors are only logged
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Unable to export spans", "error", err)
+	}))
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+		sdktrace.WithSampler(newSampler(config.SampleRatio)),
+	), nil
+}
+
+// newSampler samples requests by ratio, children follow the request span. Trace IDs of callers
+// can be picked to pass TraceIDRatioBased, so remote parents are sampled at random instead.
+func newSampler(ratio float64) sdktrace.Sampler {
+	remote := randomRatioSampler(ratio)
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio),
+		sdktrace.WithRemoteParentSampled(remote),
+		sdktrace.WithRemoteParentNotSampled(remote),
+	)
+}
+
+// randomRatioSampler samples the share of spans regardless of their trace ID.
+type randomRatioSampler float64
+
+func (s randomRatioSampler) ShouldSample(parameters sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if rand.Float64() < float64(s) {
+		decision = sdktrace.RecordAndSample
+	}
+
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(parameters.ParentContext).TraceState(),
+	}
+}
+
+func (s randomRatioSampler) Description() string {
+	return fmt.Sprintf("RandomRatio{%g}", float64(s))
+}
+
+// StartSpan starts a child of the span in ctx, or a new trace if there is none. Spans are recorded
+// by the global provider, they do nothing until one from NewTracerProvider has been installed.
+func StartSpan(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracingScopeName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// EndSpan marks the span as failed if there is an error and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// StartRequestSpan starts the server span of a request and puts it into the request context.
+// The trace of the caller is continued from the traceparent header.
+func StartRequestSpan(r *http.Request, action string) (*http.Request, trace.Span) {
+	ctx := traceContext.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := StartSpan(ctx, r.Method+" "+action, trace.SpanKindServer,
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.URLPath(r.URL.Path),
+		semconv.HTTPRoute(action),
+		attribute.String("request.id", RequestID(r)),
+	)
+
+	return r.WithContext(ctx), span
+}
+
+// decodeRequest parses the JSON body of an action.
+func decodeRequest(r *http.Request, body []byte, v any) error {
+	_, span := StartSpan(r.Context(), "json.decode", trace.SpanKindInternal, attribute.Int("body.size", len(body)))
+	err := json.Unmarshal(body, v)
+	EndSpan(span, err)
+	return err
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testTraceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentSpanID = "00f067aa0ba902b7"
+)
+
+// useCollector installs a tracer provider exporting to a fake collector, which decodes every
+// export request as the OTLP protobuf message. Spans are exported when the returned function is called.
+func useCollector(t *testing.T, sampleRatio float64) func() []*tracepb.ResourceSpans {
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 16)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected export to %s as %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		request := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Errorf("export request doesn't match the OTLP schema: %v", err)
+		}
+
+		requests <- request
+	}))
+	t.Cleanup(collector.Close)
+
+	provider, err := NewTracerProvider(context.Background(), TracingConfig{
+		Endpoint:    collector.URL + "/",
+		ServiceName: "stats-server-test",
+		SampleRatio: sampleRatio,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return func() []*tracepb.ResourceSpans {
+		if err := provider.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		close(requests)
+		exported := make([]*tracepb.ResourceSpans, 0)
+		for request := range requests {
+			exported = append(exported, request.ResourceSpans...)
+		}
+
+		return exported
+	}
+}
+
+func tracedRequest(traceParent string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/update", nil)
+	if traceParent != "" {
+		r.Header.Set("traceparent", traceParent)
+	}
+
+	r, _ = withRequestInfo(r)
+	return r
+}
+
+func TestTracingExport(t *testing.T) {
+	export := useCollector(t, 1)
+
+	r, span := StartRequestSpan(tracedRequest("00-"+testTraceID+"-"+testParentSpanID+"-01"), "update")
+	_, child := StartSpan(r.Context(), "json.decode", trace.SpanKindInternal)
+	EndSpan(child, errors.New("unexpected end of JSON input"))
+	span.End()
+
+	resourceSpans := export()
+	if len(resourceSpans) != 1 || len(resourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("expected spans of one resource and scope, got %v", resourceSpans)
+	}
+
+	serviceName := ""
+	for _, attribute := range resourceSpans[0].Resource.Attributes {
+		if attribute.Key == "service.name" {
+			serviceName = attribute.Value.GetStringValue()
+		}
+	}
+
+	if serviceName != "stats-server-test" {
+		t.Fatalf("unexpected service name %q", serviceName)
+	}
+
+	spans := make(map[string]*tracepb.Span)
+	for _, exported := range resourceSpans[0].ScopeSpans[0].Spans {
+		spans[exported.Name] = exported
+	}
+
+	server, decode := spans["POST update"], spans["json.decode"]
+	if server == nil || decode == nil {
+		t.Fatalf("expected the request and decode spans, got %v", spans)
+	}
+
+	if hex.EncodeToString(server.TraceId) != testTraceID || hex.EncodeToString(server.ParentSpanId) != testParentSpanID {
+		t.Fatal("request span doesn't continue the trace of the traceparent header")
+	}
+
+	if server.Kind != tracepb.Span_SPAN_KIND_SERVER || decode.Kind != tracepb.Span_SPAN_KIND_INTERNAL {
+		t.Fatalf("unexpected span kinds %v and %v", server.Kind, decode.Kind)
+	}
+
+	if string(decode.ParentSpanId) != string(server.SpanId) || string(decode.TraceId) != string(server.TraceId) {
+		t.Fatal("decode span is not a child of the request span")
+	}
+
+	if decode.Status.GetCode() != tracepb.Status_STATUS_CODE_ERROR || decode.Status.GetMessage() == "" {
+		t.Fatalf("expected an error status, got %v", decode.Status)
+	}
+}
+
+func exportedSpanNames(resourceSpans []*tracepb.ResourceSpans) []string {
+	names := make([]string, 0)
+	for _, resource := range resourceSpans {
+		for _, scopeSpans := range resource.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				names = append(names, span.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+func TestTracingIgnoresSampledFlagOfCallers(t *testing.T) {
+	export := useCollector(t, 0)
+
+	r, sampled := StartRequestSpan(tracedRequest("00-"+testTraceID+"-"+testParentSpanID+"-01"), "sampled")
+	_, child := StartSpan(r.Context(), "json.decode", trace.SpanKindInternal)
+	child.End()
+	sampled.End()
+	_, root := StartRequestSpan(tracedRequest("malformed"), "root")
+	root.End()
+
+	if names := exportedSpanNames(export()); len(names) != 0 {
+		t.Fatalf("expected no spans with a sample ratio of 0, got %v", names)
+	}
+}
+
+func TestTracingSamplesUnsampledCallersByRatio(t *testing.T) {
+	export := useCollector(t, 1)
+
+	_, unsampled := StartRequestSpan(tracedRequest("00-"+testTraceID+"-"+testParentSpanID+"-00"), "unsampled")
+	unsampled.End()
+
+	if names := exportedSpanNames(export()); len(names) != 1 || names[0] != "POST unsampled" {
+		t.Fatalf("expected the span of the unsampled caller, got %v", names)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bortexel/stats-server/data"
+	"github.com/bortexel/stats-server/database"
+)
+
+type UnknownStatsPolicy string
+
+const (
+	// UnknownStatsAllow keeps stats with unknown keys
+	UnknownStatsAllow UnknownStatsPolicy = "allow"
+	// UnknownStatsQuarantine removes stats with unknown keys from the update and keeps them aside
+	UnknownStatsQuarantine UnknownStatsPolicy = "quarantine"
+	// UnknownStatsReject refuses updates with unknown keys
+	UnknownStatsReject UnknownStatsPolicy = "reject"
+
+	MaxReportedInvalidStats = 50
+)
+
+// namespacedIDPattern is stricter than the game, dots would turn keys into nested paths in MongoDB.
+var namespacedIDPattern = regexp.MustCompile(`^[a-z0-9_-]+:[a-z0-9_/-]+$`)
+
+func ParseUnknownStatsPolicy(name string) (UnknownStatsPolicy, error) {
+	switch policy := UnknownStatsPolicy(name); policy {
+	case UnknownStatsAllow, UnknownStatsQuarantine, UnknownStatsReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown policy %q for unknown stats, expected allow, quarantine or reject", name)
+	}
+}
+
+// registryFor returns the registry check of a stat group: blocks, items, entities or custom stats.
+func registryFor(groupName database.StatGroupName) func(id string) bool {
+	switch groupName {
+	case database.StatMined:
+		return data.IsBlock
+	case database.StatUsed, database.StatCrafted, database.StatBroken, database.StatPickedUp, database.StatDropped:
+		return data.IsItem
+	case database.StatKilled, database.StatKilledBy:
+		return data.IsEntity
+	case database.StatCustom:
+		return data.IsCustomStat
+	default:
+		return nil
+	}
+}
+
+type StatsValidation struct {
+	// Malformed stats can't be stored in any case
+	Malformed []*database.InvalidStat `json:"malformed,omitempty"`
+	// Unknown stats are well-formed, but not present in registries
+	Unknown []*database.InvalidStat `json:"unknown,omitempty"`
+
+	// keptUnknown is set when unknown stats were allowed and stay in the update
+	keptUnknown bool
+}
+
+// Removed returns the stats taken out of the update.
+func (v *StatsValidation) Removed() []*database.InvalidStat {
+	removed := append([]*database.InvalidStat{}, v.Malformed...)
+	if !v.keptUnknown {
+		removed = append(removed, v.Unknown...)
+	}
+
+	return removed
+}
+
+func (v *StatsValidation) IsValid() bool {
+	return len(v.Malformed) == 0 && len(v.Unknown) == 0
+}
+
+func (v *StatsValidation) Error() string {
+	return fmt.Sprintf("%d malformed and %d unknown stats", len(v.Malformed), len(v.Unknown))
+}
+
+// truncate keeps responses small when a broken plugin sends thousands of bad stats.
+func (v *StatsValidation) truncate() *StatsValidation {
+	truncated := *v
+	if len(truncated.Malformed) > MaxReportedInvalidStats {
+		truncated.Malformed = truncated.Malformed[:MaxReportedInvalidStats]
+	}
+
+	if len(truncated.Unknown) > MaxReportedInvalidStats {
+		truncated.Unknown = truncated.Unknown[:MaxReportedInvalidStats]
+	}
+
+	return &truncated
+}
+
+func validateStatValue(value any) (float64, string) {
+	number, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Sprintf("value of type %T is not a number", value)
+	}
+
+	if math.IsNaN(number) || math.IsInf(number, 0) || number < 0 {
+		return 0, "value must be a non-negative number"
+	}
+
+	if number != math.Trunc(number) {
+		return 0, "value must be a whole number"
+	}
+
+	return number, ""
+}
+
+// ValidateStats removes malformed stats and, unless they are allowed, stats with unknown keys
+// from an update. Totals are computed by the server, so incoming ones are always dropped.
+func ValidateStats(stats database.StatsContainer, policy UnknownStatsPolicy) *StatsValidation {
+	validation := &StatsValidation{keptUnknown: policy == UnknownStatsAllow}
+
+	for groupName, groupStats := range stats {
+		if groupName == database.StatTotals {
+			delete(stats, groupName)
+			continue
+		}
+
+		if !database.IsKnownStatGroup(groupName) {
+			for key, value := range groupStats {
+				validation.Malformed = append(validation.Malformed, &database.InvalidStat{Group: groupName, Key: key, Value: value, Reason: "unknown stat group"})
+			}
+
+			delete(stats, groupName)
+			continue
+		}
+
+		registry := registryFor(groupName)
+		for key, value := range groupStats {
+			if !namespacedIDPattern.MatchString(key) {
+				validation.Malformed = append(validation.Malformed, &database.InvalidStat{Group: groupName, Key: key, Value: value, Reason: "key is not a namespaced ID"})
+				delete(groupStats, key)
+				continue
+			}
+
+			if _, reason := validateStatValue(value); reason != "" {
+				validation.Malformed = append(validation.Malformed, &database.InvalidStat{Group: groupName, Key: key, Value: value, Reason: reason})
+				delete(groupStats, key)
+				continue
+			}
+
+			// Only vanilla IDs are in the registries, modded ones are left alone
+			if registry != nil && strings.HasPrefix(key, "minecraft:") && !registry(key) {
+				validation.Unknown = append(validation.Unknown, &database.InvalidStat{Group: groupName, Key: key, Value: value, Reason: "not in registry"})
+				if policy != UnknownStatsAllow {
+					delete(groupStats, key)
+				}
+			}
+		}
+	}
+
+	stats[database.StatTotals] = make(database.StatsMap)
+
+	return validation
+}
+
+// QuarantineStats keeps removed stats aside, failing to do so is only logged. Allowed unknown
+// stats stay in the update, so they aren't quarantined.
+func QuarantineStats(r *http.Request, request *UpdatePlayerRequest, validation *StatsValidation) {
+	quarantined := &database.QuarantinedStats{
+		Timestamp: time.Now(),
+		Server:    request.Server.String(),
+		UUID:      request.UUID,
+		Stats:     validation.Removed(),
+	}
+
+	if len(quarantined.Stats) == 0 {
+		return
+	}
+
+	ctx, cancel := BackgroundContext(OperationWrite)
+	defer cancel()
+
+	RequestLog(r).Info("Quarantined stats", "server", quarantined.Server, "uuid", quarantined.UUID,
+		"malformed", len(validation.Malformed), "unknown", len(quarantined.Stats)-len(validation.Malformed))
+	if err := database.InsertQuarantinedStats(ctx, quarantined); err != nil {
+		RequestLog(r).Error("Unable to quarantine stats", "uuid", request.UUID, "error", err)
+	}
+}